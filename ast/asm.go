@@ -0,0 +1,334 @@
+package ast
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// Asm は、asm文の内容
+type Asm struct {
+	Template string // 命令のテンプレート。基本asm文ではそのまま出力する
+	Basic    bool   // オペランドを持たない基本asm文であるときtrue
+	Outputs  []*AsmOperand
+	Inputs   []*AsmOperand
+	Clobbers []string // 値を破壊されるレジスタの64bitの名前
+}
+
+// AsmOperand は、拡張asm文のオペランド
+type AsmOperand struct {
+	Name       string // "[name]" で付けた名前。なければ空文字列
+	Constraint string
+	Expr       *Node
+	Reg        string // 割り当てたレジスタの64bitの名前。メモリオペランドではアドレスを入れる
+	Mem        bool   // メモリオペランドであるときtrue
+	ReadWrite  bool   // "+" が付いた、読み書きする出力オペランドであるときtrue
+}
+
+// Operands は、出力オペランドと入力オペランドを、テンプレートで参照する番号の順に並べて返す
+func (a *Asm) Operands() []*AsmOperand {
+	return append(append([]*AsmOperand{}, a.Outputs...), a.Inputs...)
+}
+
+// 制約の文字で指定できるレジスタ
+var asmConstraintRegs = map[byte]string{
+	'a': "rax",
+	'b': "rbx",
+	'c': "rcx",
+	'd': "rdx",
+	'S': "rsi",
+	'D': "rdi",
+}
+
+// 制約 "r" と "m" のオペランドに割り当てるレジスタ。関数呼び出しをまたいで値を保存しなくてよいものから選ぶ
+var asmAllocatableRegs = []string{"rax", "rcx", "rdx", "rsi", "rdi", "r8", "r9", "r10", "r11"}
+
+// clobberに書けるレジスタの名前と、その64bitの名前
+var asmRegNames = func() map[string]string {
+	names := make(map[string]string)
+	for _, regs := range [][]string{
+		{"rax", "eax", "ax", "al"}, {"rbx", "ebx", "bx", "bl"}, {"rcx", "ecx", "cx", "cl"}, {"rdx", "edx", "dx", "dl"},
+		{"rsi", "esi", "si", "sil"}, {"rdi", "edi", "di", "dil"},
+		{"r8", "r8d", "r8w", "r8b"}, {"r9", "r9d", "r9w", "r9b"}, {"r10", "r10d", "r10w", "r10b"}, {"r11", "r11d", "r11w", "r11b"},
+		{"r12", "r12d", "r12w", "r12b"}, {"r13", "r13d", "r13w", "r13b"}, {"r14", "r14d", "r14w", "r14b"}, {"r15", "r15d", "r15w", "r15b"},
+	} {
+		for _, name := range regs {
+			names[name] = regs[0]
+		}
+	}
+	return names
+}()
+
+// テンプレートのオペランド参照に付けてオペランドの大きさを指定する修飾子
+var asmOperandModifiers = map[byte]int{'b': 1, 'w': 2, 'k': 4, 'q': 8}
+
+// Expand は、拡張asm文のテンプレートの "%0" や "%[name]" をオペランドに置き換えた文字列を返す。
+// operandは置き換える文字列を返す関数で、sizeは修飾子で指定された大きさ(指定がなければ0)。"%%" は "%" になる
+func (a *Asm) Expand(operand func(op *AsmOperand, size int) string) (string, error) {
+	operands := a.Operands()
+	var b strings.Builder
+	t := a.Template
+	for i := 0; i < len(t); i++ {
+		if t[i] != '%' {
+			b.WriteByte(t[i])
+			continue
+		}
+		i++
+		if i < len(t) && t[i] == '%' {
+			b.WriteByte('%')
+			continue
+		}
+		size := 0
+		if i < len(t) && asmOperandModifiers[t[i]] > 0 {
+			size = asmOperandModifiers[t[i]]
+			i++
+		}
+		var op *AsmOperand
+		switch {
+		case i < len(t) && t[i] == '[':
+			end := strings.IndexByte(t[i:], ']')
+			if end < 0 {
+				return "", xerrors.New("missing ']' after operand name")
+			}
+			name := t[i+1 : i+end]
+			for _, o := range operands {
+				if o.Name != "" && o.Name == name {
+					op = o
+				}
+			}
+			if op == nil {
+				return "", xerrors.Errorf("undefined named operand %q", name)
+			}
+			i += end
+		case i < len(t) && '0' <= t[i] && t[i] <= '9':
+			j := i
+			for j < len(t) && '0' <= t[j] && t[j] <= '9' {
+				j++
+			}
+			n, _ := strconv.Atoi(t[i:j])
+			if n >= len(operands) {
+				return "", xerrors.Errorf("operand number out of range: %d", n)
+			}
+			op = operands[n]
+			i = j - 1
+		default:
+			return "", xerrors.New("operand number missing after %-letter")
+		}
+		b.WriteString(operand(op, size))
+	}
+	return b.String(), nil
+}
+
+// asmStmt     = ("asm" | "__asm" | "__asm__") ("volatile" | "__volatile__")* "(" string+ asmOperands? ")" ";"
+// asmOperands = ":" (operand ("," operand)*)? (":" (operand ("," operand)*)? (":" (string ("," string)*)?)?)?
+//
+// asm文のキーワードの直後からasm文をparseする。tokはエラー表示に使う。
+// 最適化を行わないので、volatileの指定は読み捨てる
+func (p *TParser) asmStmt(tok *Token) (*Node, error) {
+	for p.consume("volatile") || p.consume("__volatile__") {
+	}
+	if err := p.expect("("); err != nil {
+		return nil, xerrors.Errorf("failed to parse asm statement. cause:\n%w", err)
+	}
+	tmpl, err := p.stringLiteral()
+	if err != nil {
+		return nil, err
+	}
+	a := &Asm{Template: tmpl, Basic: true}
+	if p.consume(":") {
+		a.Basic = false
+		if a.Outputs, err = p.asmOperands(); err != nil {
+			return nil, err
+		}
+		if p.consume(":") {
+			if a.Inputs, err = p.asmOperands(); err != nil {
+				return nil, err
+			}
+			if p.consume(":") {
+				if a.Clobbers, err = p.asmClobbers(); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, xerrors.Errorf("failed to parse asm statement. cause:\n%w", err)
+	}
+	if err := p.expect(";"); err != nil {
+		return nil, xerrors.Errorf("failed to parse asm statement. cause:\n%w", err)
+	}
+	if !a.Basic {
+		if err := p.checkAsmOperands(tok, a); err != nil {
+			return nil, err
+		}
+		if _, err := a.Expand(func(*AsmOperand, int) string { return "" }); err != nil {
+			return nil, p.errorAt(tok, "invalid 'asm': %v", err)
+		}
+	}
+	return &Node{Kind: AsmStmt, Asm: a}, nil
+}
+
+// operand = ("[" ident "]")? string "(" expr ")"
+//
+// オペランドの並びをparseする。並びは ":" か ")" の直前で終わり、空であってもよい
+func (p *TParser) asmOperands() ([]*AsmOperand, error) {
+	var operands []*AsmOperand
+	if p.token.kind == TKReserved && (p.token.str == ":" || p.token.str == ")") {
+		return nil, nil
+	}
+	for i := 0; i == 0 || p.consume(","); i++ {
+		op := &AsmOperand{}
+		if p.consume("[") {
+			if p.token.kind != TKIDENT {
+				return nil, p.errorAt(p.token, "expect operand name but got %q", p.token.str)
+			}
+			op.Name = p.token.str
+			p.token = p.token.next
+			p.pos++
+			if err := p.expect("]"); err != nil {
+				return nil, xerrors.Errorf("failed to parse asm operand. cause:\n%w", err)
+			}
+		}
+		constraint, err := p.stringLiteral()
+		if err != nil {
+			return nil, err
+		}
+		op.Constraint = constraint
+		if err := p.expect("("); err != nil {
+			return nil, xerrors.Errorf("failed to parse asm operand. cause:\n%w", err)
+		}
+		if op.Expr, err = p.expr(); err != nil {
+			return nil, xerrors.Errorf("failed to parse asm operand. cause:\n%w", err)
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, xerrors.Errorf("failed to parse asm operand. cause:\n%w", err)
+		}
+		operands = append(operands, op)
+	}
+	return operands, nil
+}
+
+// 破壊されるレジスタの並びをparseし、レジスタの64bitの名前を返す。
+// "memory" と "cc" は、メモリとフラグの値を保持しておくことはないので読み捨てる
+func (p *TParser) asmClobbers() ([]string, error) {
+	var clobbers []string
+	if p.token.kind == TKReserved && p.token.str == ")" {
+		return nil, nil
+	}
+	for i := 0; i == 0 || p.consume(","); i++ {
+		tok := p.token
+		name, err := p.stringLiteral()
+		if err != nil {
+			return nil, err
+		}
+		if name == "memory" || name == "cc" {
+			continue
+		}
+		reg, ok := asmRegNames[strings.TrimPrefix(name, "%")]
+		if !ok {
+			return nil, p.errorAt(tok, "unknown register name %q in 'asm'", name)
+		}
+		clobbers = append(clobbers, reg)
+	}
+	return clobbers, nil
+}
+
+// 拡張asm文aのオペランドの制約と式を検査し、各オペランドにレジスタを割り当てる。tokはエラー表示に使う。
+// 入力オペランドは出力オペランドと同じレジスタを指定してよいが、"r" と "m" のオペランドには
+// 他のオペランドが指定したレジスタと破壊されるレジスタ以外のレジスタを割り当てる
+func (p *TParser) checkAsmOperands(tok *Token, a *Asm) error {
+	reserved := make(map[string]bool)
+	for _, reg := range a.Clobbers {
+		reserved[reg] = true
+	}
+	var pending, matching []*AsmOperand
+	outputRegs, inputRegs := make(map[string]bool), make(map[string]bool)
+	for i, op := range a.Operands() {
+		output := i < len(a.Outputs)
+		c := op.Constraint
+		if output {
+			switch {
+			case strings.HasPrefix(c, "="):
+			case strings.HasPrefix(c, "+"):
+				op.ReadWrite = true
+			default:
+				return p.errorAt(tok, "output operand constraint lacks '='")
+			}
+			c = strings.TrimPrefix(c[1:], "&")
+			if !isLvalue(op.Expr) {
+				return p.errorAt(tok, "invalid lvalue in asm output %d", i)
+			}
+			if ty := typeOf(op.Expr); ty.Const {
+				return p.errorAt(tok, "cannot assign to asm output %d with const-qualified type %s", i, qualifiedName(ty))
+			}
+		}
+		regs := inputRegs
+		if output {
+			regs = outputRegs
+		}
+		switch m, err := strconv.Atoi(c); {
+		case err == nil && !output:
+			// 数字の制約は、その番号の出力オペランドと同じレジスタを使う
+			if m >= len(a.Outputs) || a.Outputs[m].Mem {
+				return p.errorAt(tok, "matching constraint references invalid operand number %d", m)
+			}
+			matching = append(matching, op)
+		case c == "r":
+			pending = append(pending, op)
+		case c == "m":
+			if !isLvalue(op.Expr) {
+				return p.errorAt(tok, "memory input %d is not directly addressable", i)
+			}
+			op.Mem = true
+			pending = append(pending, op)
+		case len(c) == 1 && asmConstraintRegs[c[0]] != "":
+			op.Reg = asmConstraintRegs[c[0]]
+			for _, reg := range a.Clobbers {
+				if reg == op.Reg {
+					return p.errorAt(tok, "asm operand %d conflicts with clobbered register %s", i, reg)
+				}
+			}
+			if regs[op.Reg] {
+				return p.errorAt(tok, "asm operand %d uses register %s that is already in use", i, op.Reg)
+			}
+			regs[op.Reg] = true
+			reserved[op.Reg] = true
+		default:
+			return p.errorAt(tok, "unsupported constraint %q in asm operand %d", op.Constraint, i)
+		}
+		if ty := lvalueConverted(typeOf(op.Expr)); !op.Mem && !ty.IsArithmetic() && ty.Kind != TyPtr {
+			return p.errorAt(tok, "asm operand %d of type %s cannot be held in a register", i, ty.Kind)
+		}
+	}
+	for _, op := range pending {
+		for _, reg := range asmAllocatableRegs {
+			if !reserved[reg] {
+				op.Reg = reg
+				reserved[reg] = true
+				break
+			}
+		}
+		if op.Reg == "" {
+			return p.errorAt(tok, "'asm' operand has impossible constraints")
+		}
+	}
+	for _, op := range matching {
+		m, _ := strconv.Atoi(op.Constraint)
+		op.Reg = a.Outputs[m].Reg
+	}
+	return nil
+}
+
+// nodeがアドレスを持つ左辺値であるときtrueを返す
+func isLvalue(node *Node) bool {
+	switch node.Kind {
+	case LocalVar, GlobalVar, Deref:
+		return true
+	case MemberAccess:
+		return !node.Member.IsBitfield
+	case Comma: // 複合リテラル
+		return isLvalue(node.Rhs)
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package ast
+
+import "golang.org/x/xerrors"
+
+// メモリオーダー。値はGCCの__ATOMIC_*マクロと同じ
+const (
+	MemoryOrderRelaxed = iota
+	MemoryOrderConsume
+	MemoryOrderAcquire
+	MemoryOrderRelease
+	MemoryOrderAcqRel
+	MemoryOrderSeqCst
+)
+
+// メモリオーダーを表す名前。#includeがないので、GCCのマクロと<stdatomic.h>の列挙定数を組み込みの名前として扱う
+var memoryOrders = map[string]int{
+	"__ATOMIC_RELAXED":     MemoryOrderRelaxed,
+	"__ATOMIC_CONSUME":     MemoryOrderConsume,
+	"__ATOMIC_ACQUIRE":     MemoryOrderAcquire,
+	"__ATOMIC_RELEASE":     MemoryOrderRelease,
+	"__ATOMIC_ACQ_REL":     MemoryOrderAcqRel,
+	"__ATOMIC_SEQ_CST":     MemoryOrderSeqCst,
+	"memory_order_relaxed": MemoryOrderRelaxed,
+	"memory_order_consume": MemoryOrderConsume,
+	"memory_order_acquire": MemoryOrderAcquire,
+	"memory_order_release": MemoryOrderRelease,
+	"memory_order_acq_rel": MemoryOrderAcqRel,
+	"memory_order_seq_cst": MemoryOrderSeqCst,
+}
+
+// アトミック操作の組み込み関数の引数の形
+type atomicBuiltin struct {
+	kind   Kind
+	orders int  // 引数に取るメモリオーダーの数。0のときはseq_cstになる
+	weak   bool // GCCの__atomic_compare_exchange_nのように、弱い比較交換を指定する引数を取るときtrue
+}
+
+// アトミック操作の組み込み関数。GCCの__atomic_*組み込み関数と、<stdatomic.h>の関数を扱う
+var atomicBuiltins = map[string]atomicBuiltin{
+	"__atomic_load_n":             {kind: AtomicLoad, orders: 1},
+	"__atomic_store_n":            {kind: AtomicStore, orders: 1},
+	"__atomic_exchange_n":         {kind: AtomicExchange, orders: 1},
+	"__atomic_compare_exchange_n": {kind: AtomicCAS, orders: 2, weak: true},
+	"__atomic_fetch_add":          {kind: AtomicFetchAdd, orders: 1},
+	"__atomic_fetch_sub":          {kind: AtomicFetchSub, orders: 1},
+	"__atomic_thread_fence":       {kind: AtomicFence, orders: 1},
+
+	"atomic_load":                             {kind: AtomicLoad},
+	"atomic_load_explicit":                    {kind: AtomicLoad, orders: 1},
+	"atomic_store":                            {kind: AtomicStore},
+	"atomic_store_explicit":                   {kind: AtomicStore, orders: 1},
+	"atomic_exchange":                         {kind: AtomicExchange},
+	"atomic_exchange_explicit":                {kind: AtomicExchange, orders: 1},
+	"atomic_compare_exchange_strong":          {kind: AtomicCAS},
+	"atomic_compare_exchange_strong_explicit": {kind: AtomicCAS, orders: 2},
+	"atomic_compare_exchange_weak":            {kind: AtomicCAS},
+	"atomic_compare_exchange_weak_explicit":   {kind: AtomicCAS, orders: 2},
+	"atomic_fetch_add":                        {kind: AtomicFetchAdd},
+	"atomic_fetch_add_explicit":               {kind: AtomicFetchAdd, orders: 1},
+	"atomic_fetch_sub":                        {kind: AtomicFetchSub},
+	"atomic_fetch_sub_explicit":               {kind: AtomicFetchSub, orders: 1},
+	"atomic_thread_fence":                     {kind: AtomicFence, orders: 1},
+}
+
+// 宣言されていない識別子tokが組み込みの名前であれば、その式をparseして返す。組み込みの名前でなければokはfalse
+func (p *TParser) builtin(tok *Token) (node *Node, ok bool, err error) {
+	if order, found := memoryOrders[tok.str]; found {
+		p.token = p.token.next
+		p.pos++
+		return newNumber(order), true, nil
+	}
+	b, found := atomicBuiltins[tok.str]
+	if !found {
+		return nil, false, nil
+	}
+	p.token = p.token.next
+	p.pos++
+	node, err = p.atomicBuiltin(tok, b)
+	return node, true, err
+}
+
+// atomicBuiltin = ident "(" (assign ("," assign)*)? ")"
+//
+// アトミック操作の組み込み関数の名前tokの直後から呼び出しをparseする。
+// 引数は操作するオブジェクトへのポインタ、(比較交換では)期待値へのポインタ、書き込む値、メモリオーダーの順に並ぶ。
+// 比較交換は常に強い比較交換として実装するので、弱い比較交換を指定する引数は定数式として読み捨てる
+func (p *TParser) atomicBuiltin(tok *Token, b atomicBuiltin) (*Node, error) {
+	if err := p.expect("("); err != nil {
+		return nil, xerrors.Errorf("failed to parse %s. cause:\n%w", tok.str, err)
+	}
+	node := &Node{Kind: b.kind, Value: MemoryOrderSeqCst}
+	if b.kind == AtomicFence {
+		order, err := p.memoryOrder(tok, b.kind, 0)
+		if err != nil {
+			return nil, err
+		}
+		node.Value = order
+		node.Type = IntType
+		if err := p.expect(")"); err != nil {
+			return nil, xerrors.Errorf("failed to parse %s. cause:\n%w", tok.str, err)
+		}
+		return node, nil
+	}
+
+	ptr, err := p.assign()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse argument of %s. cause:\n%w", tok.str, err)
+	}
+	ty, err := p.atomicObjectType(tok, b.kind, ptr)
+	if err != nil {
+		return nil, err
+	}
+	node.Lhs = ptr
+	node.Type = ty
+	if b.kind == AtomicCAS {
+		if err := p.expect(","); err != nil {
+			return nil, xerrors.Errorf("failed to parse argument of %s. cause:\n%w", tok.str, err)
+		}
+		expected, err := p.assign()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse argument of %s. cause:\n%w", tok.str, err)
+		}
+		ety := lvalueConverted(typeOf(expected))
+		if ety.Kind != TyPtr || ety.Base.Const || !isCompatible(ety.Base.Unqualified(), ty) {
+			return nil, p.errorAt(tok, "argument 2 of '%s' must be a pointer to %s", tok.str, ty.Kind)
+		}
+		node.Body = []*Node{expected}
+		node.Type = IntType // 交換できたかどうかを表す
+	}
+	if b.kind != AtomicLoad {
+		if err := p.expect(","); err != nil {
+			return nil, xerrors.Errorf("failed to parse argument of %s. cause:\n%w", tok.str, err)
+		}
+		valTok := p.token
+		val, err := p.assign()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse argument of %s. cause:\n%w", tok.str, err)
+		}
+		if err := p.checkAssignable(valTok, ty, typeOf(val)); err != nil {
+			return nil, err
+		}
+		if vty := typeOf(val); ty.Kind == TyBool || ty.IsArithmetic() && vty.IsArithmetic() {
+			val = newCast(val, ty)
+		}
+		node.Rhs = val
+	}
+	if b.weak {
+		if err := p.expect(","); err != nil {
+			return nil, xerrors.Errorf("failed to parse argument of %s. cause:\n%w", tok.str, err)
+		}
+		if _, err := p.constExpr(); err != nil {
+			return nil, p.errorAt(tok, "weak argument of '%s' is not an integer constant: %v", tok.str, err)
+		}
+	}
+	for i := 0; i < b.orders; i++ {
+		if err := p.expect(","); err != nil {
+			return nil, xerrors.Errorf("failed to parse argument of %s. cause:\n%w", tok.str, err)
+		}
+		order, err := p.memoryOrder(tok, b.kind, i)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			node.Value = order
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, xerrors.Errorf("failed to parse %s. cause:\n%w", tok.str, err)
+	}
+	return node, nil
+}
+
+// アトミック操作の組み込み関数tokの第1引数ptrの指す先の型から修飾子を取り除いた型を返す。
+// アトミックに操作できるのは整数型とポインタ型のオブジェクトで、加算と減算は_Bool以外の整数型に限る
+func (p *TParser) atomicObjectType(tok *Token, kind Kind, ptr *Node) (*Type, error) {
+	pty := lvalueConverted(typeOf(ptr))
+	if pty.Kind != TyPtr {
+		return nil, p.errorAt(tok, "argument 1 of '%s' must be a pointer type", tok.str)
+	}
+	ty := pty.Base.Unqualified()
+	switch kind {
+	case AtomicFetchAdd, AtomicFetchSub:
+		if !ty.IsInteger() || ty.Kind == TyBool {
+			return nil, p.errorAt(tok, "argument 1 of '%s' must be a pointer to a non-boolean integer type", tok.str)
+		}
+	default:
+		if !ty.IsInteger() && ty.Kind != TyPtr {
+			return nil, p.errorAt(tok, "argument 1 of '%s' must be a pointer to an integer or pointer type", tok.str)
+		}
+	}
+	if kind != AtomicLoad && pty.Base.Const {
+		return nil, p.errorAt(tok, "argument 1 of '%s' must be a pointer to a non-const type", tok.str)
+	}
+	return ty, nil
+}
+
+// アトミック操作kindのi番目のメモリオーダーの引数をparseする。
+// メモリオーダーは整数定数式でなければならず、読み出しに解放のオーダーを指定するような意味のない組み合わせはエラーにする
+func (p *TParser) memoryOrder(tok *Token, kind Kind, i int) (int, error) {
+	order, err := p.constExpr()
+	if err != nil {
+		return 0, p.errorAt(tok, "memory order argument of '%s' is not an integer constant: %v", tok.str, err)
+	}
+	invalid := order < MemoryOrderRelaxed || MemoryOrderSeqCst < order
+	switch {
+	case kind == AtomicLoad, kind == AtomicCAS && i == 1: // 比較交換の2番目は失敗したときの読み出しのオーダー
+		invalid = invalid || order == MemoryOrderRelease || order == MemoryOrderAcqRel
+	case kind == AtomicStore:
+		invalid = invalid || order == MemoryOrderConsume || order == MemoryOrderAcquire || order == MemoryOrderAcqRel
+	}
+	if invalid {
+		return 0, p.errorAt(tok, "invalid memory model %d for '%s'", order, tok.str)
+	}
+	return order, nil
+}
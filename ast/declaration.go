@@ -0,0 +1,870 @@
+package ast
+
+import "golang.org/x/xerrors"
+
+// tokが型名または宣言の始まりであるときtrueを返す
+func (p *TParser) isTypeName(tok *Token) bool {
+	if tok.kind == TKIDENT {
+		return p.isTypedefName(tok.str)
+	}
+	if tok.kind != TKReserved {
+		return false
+	}
+	switch tok.str {
+	case "struct", "union", "enum", "float", "double", "_Bool", "const", "volatile", "_Atomic", "_Alignas":
+		return true
+	}
+	return storageClasses[tok.str] || threadLocalSpecifiers[tok.str] || integerTypeSpecifiers[tok.str]
+}
+
+// declaration  = storageClass* declspec (declarator ("=" initializer)? ("," declarator ("=" initializer)?)*)? ";"
+// storageClass = "typedef" | "static" | "extern" | "_Thread_local" | "__thread"
+//
+// 宣言された変数をローカル変数として、typedef名を型の別名として現在のスコープに登録する。
+// staticとexternが付いた変数と、プログラムの最上位で宣言された変数はデータ領域に置かれる変数として登録する。
+// 関数型の宣言は、他のオブジェクトファイルで定義された関数の宣言として登録する。
+// 初期化子が付いた変数を実行時に初期化する文を並べたBlockを返す
+func (p *TParser) declaration() (*Node, error) {
+	class, thread, err := p.storageClass()
+	if err != nil {
+		return nil, err
+	}
+	specTok := p.token
+	base, align, err := p.declSpecifiers()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse declaration. cause:\n%w", err)
+	}
+	if align > 0 && class == "typedef" {
+		return nil, p.errorAt(specTok, "'_Alignas' attribute cannot be applied to a typedef")
+	}
+	node := &Node{Kind: Block}
+	for i := 0; !p.consume(";"); i++ {
+		if i > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, xerrors.Errorf("failed to parse declaration. cause:\n%w", err)
+			}
+		}
+		ty, name, err := p.declarator(base)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse declaration. cause:\n%w", err)
+		}
+		if class == "typedef" {
+			if err := p.declareSymbol(name, &symbol{kind: symTypedef, ty: ty}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if ty.Kind == TyFunc {
+			if err := p.funcDecl(name, ty, class, thread, align); err != nil {
+				return nil, xerrors.Errorf("failed to parse declaration. cause:\n%w", err)
+			}
+			continue
+		}
+		if ty, err = p.applyAlignment(name, ty, align); err != nil {
+			return nil, err
+		}
+		if thread != nil && class == "" && !p.isFileScope() {
+			return nil, p.errorAt(name, "function-scope %q implicitly auto and declared '%s'", name.str, thread.str)
+		}
+		if class == "static" {
+			if err := p.staticLocal(name, ty, thread != nil); err != nil {
+				return nil, xerrors.Errorf("failed to parse declaration. cause:\n%w", err)
+			}
+			continue
+		}
+		if class == "extern" {
+			if err := p.externDecl(name, ty, thread != nil); err != nil {
+				return nil, xerrors.Errorf("failed to parse declaration. cause:\n%w", err)
+			}
+			continue
+		}
+		if p.isFileScope() {
+			stmts, err := p.globalVar(name, ty, thread != nil)
+			if err != nil {
+				return nil, xerrors.Errorf("failed to parse declaration. cause:\n%w", err)
+			}
+			node.Body = append(node.Body, stmts...)
+			continue
+		}
+		if ty.Align > maxStackAlign {
+			return nil, p.errorAt(name, "alignment %d of local variable %q exceeds the stack alignment %d", ty.Align, name.str, maxStackAlign)
+		}
+		// 初期化子の中からも宣言した変数が見えるよう、先に変数を登録する。
+		// 要素数を省略した配列は、初期化子から要素数が決まった後で登録する
+		var lvar *LVar
+		if ty.IsComplete() {
+			if lvar, err = p.declareLVar(name, ty); err != nil {
+				return nil, err
+			}
+		}
+		if !p.consume("=") {
+			if lvar == nil {
+				return nil, p.errorAt(name, "variable %q has incomplete type", name.str)
+			}
+			continue
+		}
+		if lvar == nil && !(ty.Kind == TyArray && ty.Base.IsComplete()) {
+			return nil, p.errorAt(name, "variable %q has incomplete type", name.str)
+		}
+		init, err := p.initializer(ty)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse initializer of %q. cause:\n%w", name.str, err)
+		}
+		if lvar == nil {
+			if lvar, err = p.declareLVar(name, alignedTo(init.ty, ty.Align)); err != nil {
+				return nil, err
+			}
+		}
+		node.Body = append(node.Body, lvarInitializer(lvar, init)...)
+	}
+	return node, nil
+}
+
+// ローカル変数に指定できるアラインメントの上限。rbpは16の倍数のアドレスを指しているので、
+// rbpからのオフセットで表されるローカル変数はこれより大きいアラインメントに揃えられない
+const maxStackAlign = 16
+
+// 宣言された変数の型tyに、アラインメント指定子で指定されたアラインメントalignを適用した型を返す。
+// alignが0であれば指定はない。nameはエラー表示に使う
+func (p *TParser) applyAlignment(name *Token, ty *Type, align int) (*Type, error) {
+	if align == 0 {
+		return ty, nil
+	}
+	if align < ty.Align {
+		return nil, p.errorAt(name, "requested alignment %d is less than minimum alignment %d of %q", align, ty.Align, name.str)
+	}
+	return alignedTo(ty, align), nil
+}
+
+// 記憶域クラス指定子のキーワード
+var storageClasses = map[string]bool{
+	"typedef": true,
+	"static":  true,
+	"extern":  true,
+}
+
+// スレッド記憶域期間を指定するキーワード。"__thread" はGCCの拡張
+var threadLocalSpecifiers = map[string]bool{
+	"_Thread_local": true,
+	"__thread":      true,
+}
+
+// 記憶域クラス指定子を読み、そのキーワードを返す。指定子がなければ空文字列を返す。
+// "_Thread_local" は "static" か "extern" と組み合わせられるので別に扱い、そのトークンを返す。なければnilを返す
+func (p *TParser) storageClass() (string, *Token, error) {
+	var class string
+	var thread *Token
+	for p.token.kind == TKReserved && (storageClasses[p.token.str] || threadLocalSpecifiers[p.token.str]) {
+		tok := p.token
+		switch {
+		case threadLocalSpecifiers[tok.str]:
+			if thread != nil {
+				return "", nil, p.errorAt(tok, "duplicate '%s'", tok.str)
+			}
+			thread = tok
+		case class != "":
+			return "", nil, p.errorAt(tok, "multiple storage classes in declaration specifiers")
+		default:
+			class = tok.str
+		}
+		if thread != nil && class == "typedef" {
+			return "", nil, p.errorAt(tok, "'%s' used with 'typedef'", thread.str)
+		}
+		p.token = p.token.next
+		p.pos++
+	}
+	return class, thread, nil
+}
+
+// 型tyのローカル変数を確保し、nameの名前で現在のスコープに登録する
+func (p *TParser) declareLVar(name *Token, ty *Type) (*LVar, error) {
+	lvar := p.newLVar(name.str, ty)
+	if err := p.declareSymbol(name, &symbol{kind: symVar, lvar: lvar}); err != nil {
+		return nil, err
+	}
+	return lvar, nil
+}
+
+// declspec = typeQualifier* typeSpecifier typeQualifier*
+//
+// 型名と関数の引数の宣言指定子をparseする。これらにはアラインメント指定子を書けない
+func (p *TParser) declspec() (*Type, error) {
+	tok := p.token
+	ty, align, err := p.declSpecifiers()
+	if err != nil {
+		return nil, err
+	}
+	if align > 0 {
+		return nil, p.errorAt(tok, "'_Alignas' attribute cannot be applied to a type name or parameter")
+	}
+	return ty, nil
+}
+
+// declSpecifiers = (typeQualifier | alignas)* typeSpecifier (typeQualifier | alignas)*
+// typeQualifier  = "const" | "volatile" | "_Atomic"
+//
+// 変数とメンバーの宣言指定子をparseし、型とアラインメント指定子で指定されたアラインメントを返す。
+// 型修飾子とアラインメント指定子は型指定子の前後に任意の順番で書ける。アラインメントの指定がなければ0を返す
+func (p *TParser) declSpecifiers() (*Type, int, error) {
+	tok := p.token
+	var q qualifiers
+	align, err := p.qualifiersAndAlignas(&q, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	ty, err := p.typeSpecifier(&q)
+	if err != nil {
+		return nil, 0, err
+	}
+	if align, err = p.qualifiersAndAlignas(&q, align); err != nil {
+		return nil, 0, err
+	}
+	if q.isAtomic {
+		if err := p.checkAtomic(tok, ty); err != nil {
+			return nil, 0, err
+		}
+	}
+	return p.qualify(ty, q), align, nil
+}
+
+// qualify は、tyに修飾子qを加えた型を返す。修飾された型はtyのコピーなので、tyが不完全な構造体型・共用体型であれば、
+// 後の宣言で元の型が完成したときに大きさとメンバーを反映できるよう記録しておく
+func (p *TParser) qualify(ty *Type, q qualifiers) *Type {
+	qualified := qualify(ty, q)
+	if qualified != ty && !ty.IsComplete() && (ty.Kind == TyStruct || ty.Kind == TyUnion) {
+		origin := ty.Unqualified()
+		p.incompleteQualified[origin] = append(p.incompleteQualified[origin], qualified)
+	}
+	return qualified
+}
+
+// 完成した構造体型・共用体型tyの大きさ、アラインメント、メンバーを、tyが不完全なうちに作られた修飾された型に反映する
+func (p *TParser) completeQualified(ty *Type) {
+	for _, qualified := range p.incompleteQualified[ty] {
+		qualified.Size = ty.Size
+		qualified.Align = ty.Align
+		qualified.Members = ty.Members
+	}
+	delete(p.incompleteQualified, ty)
+}
+
+// 型tyを_Atomic修飾できることを確かめる。アトミックな読み書きは1命令で行うので、
+// 8byte以下のスカラー型だけを_Atomic修飾できる。tokはエラー表示に使う
+func (p *TParser) checkAtomic(tok *Token, ty *Type) error {
+	if !ty.IsArithmetic() && ty.Kind != TyPtr {
+		return p.errorAt(tok, "'_Atomic' cannot be applied to %s type", ty.Kind)
+	}
+	return nil
+}
+
+// 型修飾子とアラインメント指定子を読めるだけ読み、型修飾子はqに加える。
+// alignとアラインメント指定子のうち最も大きいアラインメントを返す
+func (p *TParser) qualifiersAndAlignas(q *qualifiers, align int) (int, error) {
+	for {
+		p.typeQualifiers(q)
+		tok := p.token
+		if !p.consume("_Alignas") {
+			return align, nil
+		}
+		n, err := p.alignas(tok)
+		if err != nil {
+			return 0, err
+		}
+		if align < n {
+			align = n
+		}
+	}
+}
+
+// alignas = "_Alignas" "(" (typeName | equality) ")"
+//
+// "_Alignas" の直後からアラインメント指定子をparseし、指定されたアラインメントを返す。tokはエラー表示に使う
+func (p *TParser) alignas(tok *Token) (int, error) {
+	if err := p.expect("("); err != nil {
+		return 0, xerrors.Errorf("failed to parse _Alignas. cause:\n%w", err)
+	}
+	var align int
+	if p.isTypeName(p.token) {
+		ty, err := p.typeName()
+		if err != nil {
+			return 0, xerrors.Errorf("failed to parse _Alignas. cause:\n%w", err)
+		}
+		align = ty.Align
+	} else {
+		n, err := p.constExpr()
+		if err != nil {
+			return 0, p.errorAt(tok, "alignment is not an integer constant: %v", err)
+		}
+		if n <= 0 || n&(n-1) != 0 {
+			return 0, p.errorAt(tok, "requested alignment %d is not a positive power of 2", n)
+		}
+		align = n
+	}
+	if err := p.expect(")"); err != nil {
+		return 0, xerrors.Errorf("failed to parse _Alignas. cause:\n%w", err)
+	}
+	return align, nil
+}
+
+// 型修飾子を読めるだけ読み、qに加える。"(" が続く "_Atomic" は型指定子なので読まない
+func (p *TParser) typeQualifiers(q *qualifiers) {
+	for {
+		switch {
+		case p.consume("const"):
+			q.isConst = true
+		case p.consume("volatile"):
+			q.isVolatile = true
+		case !p.isAtomicTypeSpecifier() && p.consume("_Atomic"):
+			q.isAtomic = true
+		default:
+			return
+		}
+	}
+}
+
+// 現在のトークンが "_Atomic" "(" typeName ")" の形の型指定子の始まりであるときtrueを返す
+func (p *TParser) isAtomicTypeSpecifier() bool {
+	tok := p.token
+	return tok.kind == TKReserved && tok.str == "_Atomic" &&
+		tok.next != nil && tok.next.kind == TKReserved && tok.next.str == "("
+}
+
+// typeSpecifier = integerType | "_Bool" | "float" | "double" | "struct" structUnionDecl | "union" structUnionDecl | "enum" enumDecl | typedefName | "_Atomic" "(" typeName ")"
+//
+// 整数型の型指定子の間に現れた型修飾子はqに加える
+func (p *TParser) typeSpecifier(q *qualifiers) (*Type, error) {
+	if p.isIntegerTypeSpecifier() {
+		return p.integerType(q)
+	}
+	if tok := p.token; p.isAtomicTypeSpecifier() {
+		p.consume("_Atomic")
+		p.consume("(")
+		ty, err := p.typeName()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse _Atomic type specifier. cause:\n%w", err)
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, xerrors.Errorf("failed to parse _Atomic type specifier. cause:\n%w", err)
+		}
+		if err := p.checkAtomic(tok, ty); err != nil {
+			return nil, err
+		}
+		return qualify(ty, qualifiers{isAtomic: true}), nil
+	}
+	if p.consume("_Bool") {
+		return BoolType, nil
+	}
+	if p.consume("float") {
+		return FloatType, nil
+	}
+	if p.consume("double") {
+		return DoubleType, nil
+	}
+	if p.token.kind == TKIDENT && p.isTypedefName(p.token.str) {
+		ty := p.findSymbol(p.token.str).ty
+		p.token = p.token.next
+		p.pos++
+		return ty, nil
+	}
+	if p.consume("struct") {
+		return p.structUnionDecl(TyStruct)
+	}
+	if p.consume("union") {
+		return p.structUnionDecl(TyUnion)
+	}
+	if p.consume("enum") {
+		return p.enumDecl()
+	}
+	return nil, p.errorAt(p.token, "expect type name but got %q", p.token.str)
+}
+
+// 整数型を表す型指定子のキーワード
+var integerTypeSpecifiers = map[string]bool{
+	"short":    true,
+	"int":      true,
+	"long":     true,
+	"signed":   true,
+	"unsigned": true,
+}
+
+// 現在のトークンが整数型を表す型指定子であるときtrueを返す
+func (p *TParser) isIntegerTypeSpecifier() bool {
+	return p.token.kind == TKReserved && integerTypeSpecifiers[p.token.str]
+}
+
+// integerType = ("short" | "int" | "long" | "signed" | "unsigned") (typeQualifier* ("short" | "int" | "long" | "signed" | "unsigned"))*
+//
+// 型指定子は任意の順番で並べられる。"long long int" のように同じ指定子を複数回書ける場合があるので、
+// 各指定子の出現回数から型を決める。"unsigned const int" のように間に現れた型修飾子はqに加える
+func (p *TParser) integerType(q *qualifiers) (*Type, error) {
+	start := p.token
+	count := make(map[string]int)
+	for p.typeQualifiers(q); p.isIntegerTypeSpecifier(); p.typeQualifiers(q) {
+		count[p.token.str]++
+		p.token = p.token.next
+		p.pos++
+	}
+	invalid := count["int"] > 1 || count["short"] > 1 || count["long"] > 2 ||
+		count["signed"] > 1 || count["unsigned"] > 1 ||
+		count["short"] > 0 && count["long"] > 0 ||
+		count["signed"] > 0 && count["unsigned"] > 0
+	if invalid {
+		return nil, p.errorAt(start, "invalid combination of type specifiers")
+	}
+	unsigned := count["unsigned"] > 0
+	switch {
+	case count["short"] > 0 && unsigned:
+		return UShortType, nil
+	case count["short"] > 0:
+		return ShortType, nil
+	case count["long"] == 2 && unsigned:
+		return ULongLongType, nil
+	case count["long"] == 2:
+		return LongLongType, nil
+	case count["long"] == 1 && unsigned:
+		return ULongType, nil
+	case count["long"] == 1:
+		return LongType, nil
+	case unsigned:
+		return UIntType, nil
+	}
+	return IntType, nil
+}
+
+// declarator = ("*" typeQualifier*)* ("(" declarator ")" | ident) typeSuffix
+//
+// baseを元に宣言された変数の型と、変数名のトークンを返す。要素数を省略した配列は不完全型になる
+func (p *TParser) declarator(base *Type) (*Type, *Token, error) {
+	return p.parseDeclarator(base, false)
+}
+
+// abstractDeclarator = ("*" typeQualifier*)* ("(" abstractDeclarator ")")? typeSuffix
+//
+// 型名や関数の引数に現れる、変数名を省略できる宣言子をparseする。変数名が省略された場合はnilを返す
+func (p *TParser) abstractDeclarator(base *Type) (*Type, *Token, error) {
+	return p.parseDeclarator(base, true)
+}
+
+// 宣言子をparseする。abstractがtrueのとき変数名を省略できる
+func (p *TParser) parseDeclarator(base *Type, abstract bool) (*Type, *Token, error) {
+	ty := base
+	for p.consume("*") {
+		var q qualifiers
+		p.typeQualifiers(&q)
+		ty = qualify(PointerTo(ty), q)
+	}
+	if p.isNestedDeclarator(abstract) {
+		// "int (*x)[3]" のように括弧で囲まれた宣言子は、括弧の後の型接尾辞を適用した型を元にするので、
+		// いったん括弧の中を読み飛ばして型接尾辞を先に読み、括弧の中に戻ってparseし直す
+		start := p.token.next
+		p.consume("(")
+		if _, _, err := p.parseDeclarator(IntType, abstract); err != nil {
+			return nil, nil, xerrors.Errorf("failed to parse nested declarator. cause:\n%w", err)
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, nil, xerrors.Errorf("failed to parse nested declarator. cause:\n%w", err)
+		}
+		ty, err := p.typeSuffix(ty)
+		if err != nil {
+			return nil, nil, err
+		}
+		end := p.token
+		p.token = start
+		ty, name, err := p.parseDeclarator(ty, abstract)
+		if err != nil {
+			return nil, nil, err
+		}
+		p.token = end
+		return ty, name, nil
+	}
+	var name *Token
+	if p.token.kind == TKIDENT {
+		name = p.token
+		p.token = p.token.next
+		p.pos++
+	} else if !abstract {
+		return nil, nil, p.errorAt(p.token, "expect variable name but got %q", p.token.str)
+	}
+	ty, err := p.typeSuffix(ty)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ty, name, nil
+}
+
+// 現在のトークンが括弧で囲まれた宣言子の始まりであるときtrueを返す。
+// 変数名を省略できる場合、"int (int)" のような関数型の引数リストの括弧とは区別する
+func (p *TParser) isNestedDeclarator(abstract bool) bool {
+	if p.token.kind != TKReserved || p.token.str != "(" {
+		return false
+	}
+	if !abstract {
+		return true
+	}
+	next := p.token.next
+	if next.kind == TKIDENT {
+		return !p.isTypedefName(next.str)
+	}
+	return next.kind == TKReserved && (next.str == "*" || next.str == "(" || next.str == "[")
+}
+
+// typeSuffix = "(" funcParams | "[" equality? "]" typeSuffix | ε
+func (p *TParser) typeSuffix(ty *Type) (*Type, error) {
+	if tok := p.token; p.consume("(") {
+		if ty.Kind == TyArray || ty.Kind == TyFunc {
+			return nil, p.errorAt(tok, "function cannot return %s type", ty.Kind)
+		}
+		return p.funcParams(ty)
+	}
+	if tok := p.token; p.consume("[") {
+		n := -1
+		if !p.consume("]") {
+			var err error
+			if n, err = p.constExpr(); err != nil {
+				return nil, p.errorAt(tok, "array size is not an integer constant: %v", err)
+			}
+			if n < 0 {
+				return nil, p.errorAt(tok, "array has negative size")
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, xerrors.Errorf("failed to parse array declarator. cause:\n%w", err)
+			}
+		}
+		// "int a[2][3]" は要素数3の配列を要素とする要素数2の配列になるので、後ろの型接尾辞を先に適用する
+		elem, err := p.typeSuffix(ty)
+		if err != nil {
+			return nil, err
+		}
+		if !elem.IsComplete() {
+			return nil, p.errorAt(tok, "array has incomplete element type %s", elem.Kind)
+		}
+		return ArrayOf(elem, n), nil
+	}
+	return ty, nil
+}
+
+// funcParams = (param ("," param)*)? ")"
+// param      = declspec abstractDeclarator
+//
+// "(" の直後から関数の引数リストをparseし、戻り値の型がretの関数型を返す。
+// 配列型と関数型の引数は、それを指すポインタ型として扱う
+func (p *TParser) funcParams(ret *Type) (*Type, error) {
+	var params []*Type
+	for i := 0; !p.consume(")"); i++ {
+		if i > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, xerrors.Errorf("failed to parse parameter list. cause:\n%w", err)
+			}
+		}
+		base, err := p.declspec()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse parameter list. cause:\n%w", err)
+		}
+		ty, _, err := p.abstractDeclarator(base)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse parameter list. cause:\n%w", err)
+		}
+		switch ty.Kind {
+		case TyArray:
+			ty = PointerTo(ty.Base)
+		case TyFunc:
+			ty = PointerTo(ty)
+		}
+		params = append(params, ty)
+	}
+	return FuncType(ret, params), nil
+}
+
+// 整数定数式をparseし、その値を返す
+func (p *TParser) constExpr() (int, error) {
+	node, err := p.equality()
+	if err != nil {
+		return 0, err
+	}
+	return eval(node)
+}
+
+// typeName = declspec abstractDeclarator
+//
+// キャストなどに現れる、変数名を伴わない型名をparseする
+func (p *TParser) typeName() (*Type, error) {
+	base, err := p.declspec()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse type name. cause:\n%w", err)
+	}
+	tok := p.token
+	ty, name, err := p.abstractDeclarator(base)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse type name. cause:\n%w", err)
+	}
+	if name != nil {
+		return nil, p.errorAt(tok, "unexpected name %q in type name", name.str)
+	}
+	return ty, nil
+}
+
+// structUnionDecl = ident? ("{" (declspec declarator ("," declarator)* ";")* "}")?
+//
+// "struct" または "union" の直後から、kindで指定された構造体型または共用体型をparseする。
+// メンバーの定義がないタグ名は、まだ定義されていなければ不完全型として登録し、後から定義できるようにする
+func (p *TParser) structUnionDecl(kind TypeKind) (*Type, error) {
+	var tag *Token
+	if p.token.kind == TKIDENT {
+		tag = p.token
+		p.token = p.token.next
+		p.pos++
+	}
+	if tag != nil && !p.consume("{") {
+		ty, err := p.findTag(tag, kind)
+		if err != nil {
+			return nil, err
+		}
+		if ty != nil {
+			return ty, nil
+		}
+		ty = &Type{Kind: kind, Size: -1, Align: 1}
+		p.curScope().tags[tag.str] = ty
+		return ty, nil
+	}
+	if tag == nil {
+		if err := p.expect("{"); err != nil {
+			return nil, xerrors.Errorf("failed to parse %s. cause:\n%w", kind, err)
+		}
+	}
+
+	var members []*Member
+	for !p.consume("}") {
+		if tok := p.token; p.consume("_Static_assert") {
+			if err := p.staticAssert(tok); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		base, align, err := p.declSpecifiers()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse %s member. cause:\n%w", kind, err)
+		}
+		for i := 0; !p.consume(";"); i++ {
+			if i > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, xerrors.Errorf("failed to parse %s member. cause:\n%w", kind, err)
+				}
+			}
+			if tok := p.token; p.consume(":") { // 名前のないビットフィールド
+				m, err := p.bitfield(tok, &Member{Type: base})
+				if err != nil {
+					return nil, err
+				}
+				members = append(members, m)
+				continue
+			}
+			ty, name, err := p.declarator(base)
+			if err != nil {
+				return nil, xerrors.Errorf("failed to parse %s member. cause:\n%w", kind, err)
+			}
+			if !ty.IsComplete() {
+				return nil, p.errorAt(name, "field %q has incomplete type", name.str)
+			}
+			if ty, err = p.applyAlignment(name, ty, align); err != nil {
+				return nil, err
+			}
+			for _, m := range members {
+				if m.Name == name.str {
+					return nil, p.errorAt(name, "duplicate member %q", name.str)
+				}
+			}
+			m := &Member{Name: name.str, Type: ty}
+			if p.consume(":") {
+				if m, err = p.bitfield(name, m); err != nil {
+					return nil, err
+				}
+			}
+			members = append(members, m)
+		}
+	}
+
+	ty := &Type{Kind: kind}
+	if tag != nil {
+		// 同じスコープで不完全型として登録済みであれば、それを指すポインタ型からもメンバーが見えるよう同じTypeを完成させる
+		registered, err := p.findTagInCurScope(tag, kind)
+		if err != nil {
+			return nil, err
+		}
+		if registered != nil {
+			if registered.IsComplete() {
+				return nil, p.errorAt(tag, "redefinition of %s %q", kind, tag.str)
+			}
+			ty = registered
+		}
+		p.curScope().tags[tag.str] = ty
+	}
+	if kind == TyUnion {
+		ty.setUnionLayout(members)
+	} else {
+		ty.setStructLayout(members)
+	}
+	p.completeQualified(ty)
+	return ty, nil
+}
+
+// staticAssert = "_Static_assert" "(" equality ("," string)? ")" ";"
+//
+// "_Static_assert" の直後から静的アサーションをparseし、コンパイル時に式を評価する。
+// 式の値が0であれば、メッセージを付けたエラーを返す。tokはエラー表示に使う
+func (p *TParser) staticAssert(tok *Token) error {
+	if err := p.expect("("); err != nil {
+		return xerrors.Errorf("failed to parse _Static_assert. cause:\n%w", err)
+	}
+	exprTok := p.token
+	v, err := p.constExpr()
+	if err != nil {
+		return p.errorAt(exprTok, "static assertion expression is not an integer constant expression: %v", err)
+	}
+	var msg string
+	if p.consume(",") {
+		if p.token.kind != TKStr {
+			return p.errorAt(p.token, "expect string literal but got %q", p.token.str)
+		}
+		msg = p.token.str
+		p.token = p.token.next
+		p.pos++
+	}
+	if err := p.expect(")"); err != nil {
+		return xerrors.Errorf("failed to parse _Static_assert. cause:\n%w", err)
+	}
+	if err := p.expect(";"); err != nil {
+		return xerrors.Errorf("failed to parse _Static_assert. cause:\n%w", err)
+	}
+	if v != 0 {
+		return nil
+	}
+	if msg == "" {
+		return p.errorAt(tok, "static assertion failed")
+	}
+	return p.errorAt(tok, "static assertion failed: %s", msg)
+}
+
+// ":" の直後からビットフィールドの幅をparseし、メンバーmをビットフィールドにして返す。
+// tokはメンバー名のトークン(名前がなければ ":" のトークン)で、エラー表示に使う
+func (p *TParser) bitfield(tok *Token, m *Member) (*Member, error) {
+	name := m.Name
+	if name == "" {
+		name = "(anonymous)"
+	}
+	if !m.Type.IsInteger() {
+		return nil, p.errorAt(tok, "bit-field %q has non-integral type %s", name, m.Type.Kind)
+	}
+	if m.Type.Atomic {
+		return nil, p.errorAt(tok, "bit-field %q has atomic type", name)
+	}
+	width, err := p.constExpr()
+	if err != nil {
+		return nil, p.errorAt(tok, "bit-field %q width is not an integer constant: %v", name, err)
+	}
+	typeWidth := m.Type.Size * 8
+	if m.Type.Kind == TyBool {
+		typeWidth = 1
+	}
+	switch {
+	case width < 0:
+		return nil, p.errorAt(tok, "bit-field %q has negative width (%d)", name, width)
+	case width == 0 && m.Name != "":
+		return nil, p.errorAt(tok, "named bit-field %q has zero width", name)
+	case width > typeWidth:
+		return nil, p.errorAt(tok, "width of bit-field %q (%d bits) exceeds the width of its type (%d bits)", name, width, typeWidth)
+	}
+	m.IsBitfield = true
+	m.BitWidth = width
+	return m, nil
+}
+
+// enumDecl = ident? ("{" ident ("=" equality)? ("," ident ("=" equality)?)* ","? "}")?
+//
+// "enum" の直後から列挙型をparseし、列挙定数を登録する。
+// 列挙定数の値は、明示されていなければ直前の列挙定数の値+1(最初の列挙定数は0)になる
+func (p *TParser) enumDecl() (*Type, error) {
+	var tag *Token
+	if p.token.kind == TKIDENT {
+		tag = p.token
+		p.token = p.token.next
+		p.pos++
+	}
+	if tag != nil && !p.consume("{") {
+		ty, err := p.findTag(tag, TyEnum)
+		if err != nil {
+			return nil, err
+		}
+		if ty == nil {
+			return nil, p.errorAt(tag, "use of undeclared enum %q", tag.str)
+		}
+		return ty, nil
+	}
+	if tag == nil {
+		if err := p.expect("{"); err != nil {
+			return nil, xerrors.Errorf("failed to parse enum. cause:\n%w", err)
+		}
+	}
+
+	ty := &Type{Kind: TyEnum, Size: IntType.Size, Align: IntType.Align}
+	if tag != nil {
+		registered, err := p.findTagInCurScope(tag, TyEnum)
+		if err != nil {
+			return nil, err
+		}
+		if registered != nil {
+			return nil, p.errorAt(tag, "redefinition of enum %q", tag.str)
+		}
+		p.curScope().tags[tag.str] = ty
+	}
+	val := 0
+	for i := 0; !p.consume("}"); i++ {
+		if i > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, xerrors.Errorf("failed to parse enum. cause:\n%w", err)
+			}
+			if p.consume("}") { // 末尾のカンマ
+				break
+			}
+		}
+		name := p.token
+		if name.kind != TKIDENT {
+			return nil, p.errorAt(name, "expect enumerator name but got %q", name.str)
+		}
+		p.token = p.token.next
+		p.pos++
+		if tok := p.token; p.consume("=") {
+			node, err := p.equality()
+			if err != nil {
+				return nil, xerrors.Errorf("failed to parse enumerator value. cause:\n%w", err)
+			}
+			if val, err = eval(node); err != nil {
+				return nil, p.errorAt(tok, "enumerator value is not an integer constant: %v", err)
+			}
+		}
+		if err := p.declareSymbol(name, &symbol{kind: symEnumConst, val: val}); err != nil {
+			return nil, err
+		}
+		val++
+	}
+	return ty, nil
+}
+
+// 内側のスコープから順にタグ名tagに対応する型を検索して返す。タグが登録されていなければnilを返す。
+// 同じタグ名が別の種類の型に使われている場合はエラーを返す
+func (p *TParser) findTag(tag *Token, kind TypeKind) (*Type, error) {
+	return p.checkTagKind(tag, p.findTagType(tag.str), kind)
+}
+
+// 現在のスコープでタグ名tagに対応する型を検索して返す。タグが登録されていなければnilを返す。
+// 同じタグ名が別の種類の型に使われている場合はエラーを返す
+func (p *TParser) findTagInCurScope(tag *Token, kind TypeKind) (*Type, error) {
+	return p.checkTagKind(tag, p.curScope().tags[tag.str], kind)
+}
+
+// タグ名tagで見つかった型tyがkindの型であることを確かめて返す
+func (p *TParser) checkTagKind(tag *Token, ty *Type, kind TypeKind) (*Type, error) {
+	if ty != nil && ty.Kind != kind {
+		return nil, p.errorAt(tag, "use of %q with tag type %s that does not match previous declaration as %s", tag.str, kind, ty.Kind)
+	}
+	return ty, nil
+}
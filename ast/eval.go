@@ -0,0 +1,164 @@
+package ast
+
+import "golang.org/x/xerrors"
+
+// eval は、整数定数式のNodeをコンパイル時に評価した値を返す。
+// 定数式でないNodeが含まれている場合はエラーを返す。
+func eval(node *Node) (int, error) {
+	if node.Kind == Num {
+		if node.Type != nil && node.Type.IsFlonum() {
+			return 0, xerrors.Errorf("floating constant %v is not an integer constant expression", node.FVal)
+		}
+		return node.Value, nil
+	}
+	if node.Kind == Cast {
+		if typeOf(node.Lhs).IsFlonum() {
+			v, err := evalFloat(node.Lhs)
+			if err != nil {
+				return 0, err
+			}
+			return floatToInt(v, node.Type), nil
+		}
+		v, err := eval(node.Lhs)
+		if err != nil {
+			return 0, err
+		}
+		return truncateInt(v, node.Type), nil
+	}
+	lhs, rhs, err := evalOperands(node)
+	if err != nil {
+		return 0, err
+	}
+	switch node.Kind {
+	case Add:
+		return lhs + rhs, nil
+	case Sub:
+		return lhs - rhs, nil
+	case Mul:
+		return lhs * rhs, nil
+	case Div:
+		if rhs == 0 {
+			return 0, xerrors.New("division by zero in constant expression")
+		}
+		return lhs / rhs, nil
+	case Eq:
+		return boolToInt(lhs == rhs), nil
+	case Neq:
+		return boolToInt(lhs != rhs), nil
+	case LT:
+		return boolToInt(lhs < rhs), nil
+	case LE:
+		return boolToInt(lhs <= rhs), nil
+	}
+	return 0, xerrors.Errorf("node of kind %q is not a constant expression", node.Kind)
+}
+
+// evalFloat は、算術型の定数式のNodeをコンパイル時に浮動小数点数として評価した値を返す。
+// 定数式でないNodeが含まれている場合はエラーを返す。
+func evalFloat(node *Node) (float64, error) {
+	switch node.Kind {
+	case Num:
+		if node.Type != nil && node.Type.IsFlonum() {
+			return node.FVal, nil
+		}
+		return intToFloat(node.Value, typeOf(node)), nil
+	case Cast:
+		if node.Type.IsInteger() {
+			v, err := eval(node)
+			return intToFloat(v, node.Type), err
+		}
+		v, err := evalFloat(node.Lhs)
+		if node.Type.Kind == TyFloat {
+			v = float64(float32(v))
+		}
+		return v, err
+	case Neg:
+		v, err := evalFloat(node.Lhs)
+		return -v, err
+	case Add, Sub, Mul, Div:
+		if node.Lhs == nil || node.Rhs == nil {
+			break
+		}
+		lhs, err := evalFloat(node.Lhs)
+		if err != nil {
+			return 0, err
+		}
+		rhs, err := evalFloat(node.Rhs)
+		if err != nil {
+			return 0, err
+		}
+		switch node.Kind {
+		case Add:
+			return lhs + rhs, nil
+		case Sub:
+			return lhs - rhs, nil
+		case Mul:
+			return lhs * rhs, nil
+		}
+		return lhs / rhs, nil
+	}
+	return 0, xerrors.Errorf("node of kind %q is not a constant expression", node.Kind)
+}
+
+// floatToInt は、浮動小数点数vを整数型tyの値に変換する。小数部は切り捨てるが、_Bool型には0.5のような値も1に変換する。
+// 符号なし64bitの型には、int64で表せない2^63以上の値もuint64を経由して変換する
+func floatToInt(v float64, ty *Type) int {
+	switch {
+	case ty.Kind == TyBool:
+		return boolToInt(v != 0)
+	case ty.Unsigned && ty.Size == 8 && v >= 1<<63:
+		return int(uint64(v))
+	}
+	return truncateInt(int(v), ty)
+}
+
+// intToFloat は、整数型tyの値vを浮動小数点数に変換する。符号なし64bitの型の値は負の数ではなく2^63以上の値として扱う
+func intToFloat(v int, ty *Type) float64 {
+	if ty.Unsigned && ty.Size == 8 {
+		return float64(uint64(v))
+	}
+	return float64(v)
+}
+
+// 整数vを整数型tyの値の範囲に切り詰める。_Bool型には0または1に変換する。tyが整数型でなければvをそのまま返す
+func truncateInt(v int, ty *Type) int {
+	if !ty.IsInteger() {
+		return v
+	}
+	switch {
+	case ty.Kind == TyBool:
+		return boolToInt(v != 0)
+	case ty.Size == 2 && ty.Unsigned:
+		return int(uint16(v))
+	case ty.Size == 2:
+		return int(int16(v))
+	case ty.Size == 4 && ty.Unsigned:
+		return int(uint32(v))
+	case ty.Size == 4:
+		return int(int32(v))
+	}
+	return v
+}
+
+// 二項演算のNodeの両辺を評価する
+func evalOperands(node *Node) (int, int, error) {
+	if node.Lhs == nil || node.Rhs == nil {
+		return 0, 0, xerrors.Errorf("node of kind %q is not a constant expression", node.Kind)
+	}
+	lhs, err := eval(node.Lhs)
+	if err != nil {
+		return 0, 0, err
+	}
+	rhs, err := eval(node.Rhs)
+	if err != nil {
+		return 0, 0, err
+	}
+	return lhs, rhs, nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
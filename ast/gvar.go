@@ -0,0 +1,166 @@
+package ast
+
+// GVar は、静的記憶域期間を持つ変数。スタックではなくデータ領域に置かれ、アセンブリ上のラベルで参照する
+type GVar struct {
+	Label       string // アセンブリ上のラベル
+	Name        string // 外部結合を持つ変数の名前。空でなければ、ラベルと同じ位置にこの名前のシンボルを公開する
+	Type        *Type
+	Init        []byte // 初期値のバイト列。nilであれば0で初期化する
+	Extern      bool   // 他のオブジェクトファイルで定義された変数を参照するときtrue。領域は確保しない
+	ThreadLocal bool   // スレッド記憶域期間を持つときtrue。スレッドごとに別の領域を持つ
+}
+
+// Globals は、parseしたプログラムに現れた静的記憶域期間を持つ変数を返す
+func (p *TParser) Globals() []*GVar {
+	return p.globals
+}
+
+// "static" が付いたローカル変数を宣言する。変数はデータ領域に置かれ、初期化子は定数式でなければならない。
+// 初期化はプログラムの開始前に一度だけ行われるので、初期化のための文は生成しない。
+// threadがtrueのとき、変数はスレッドごとに確保される
+func (p *TParser) staticLocal(name *Token, ty *Type, thread bool) error {
+	gvar := &GVar{Label: p.newLabel("static." + name.str), Type: ty, ThreadLocal: thread}
+	sym := &symbol{kind: symVar, gvar: gvar}
+	if ty.IsComplete() {
+		if err := p.declareSymbol(name, sym); err != nil {
+			return err
+		}
+	}
+	if p.consume("=") {
+		if !ty.IsComplete() && !(ty.Kind == TyArray && ty.Base.IsComplete()) {
+			return p.errorAt(name, "variable %q has incomplete type", name.str)
+		}
+		init, err := p.initializer(ty)
+		if err != nil {
+			return err
+		}
+		gvar.Type = alignedTo(init.ty, ty.Align)
+		gvar.Init = make([]byte, init.ty.Size)
+		if err := p.writeInitData(init, gvar.Init, 0); err != nil {
+			return err
+		}
+	} else if !ty.IsComplete() {
+		return p.errorAt(name, "variable %q has incomplete type", name.str)
+	}
+	if !ty.IsComplete() {
+		if err := p.declareSymbol(name, sym); err != nil {
+			return err
+		}
+	}
+	p.globals = append(p.globals, gvar)
+	return nil
+}
+
+// プログラムの最上位で記憶域クラス指定子を付けずに宣言された変数を、外部結合を持つグローバル変数として宣言する。
+// 変数はデータ領域に置かれ、初期化子が定数式であれば初期値をデータとして書き込む。
+// プログラムの最上位はmain関数の本体でもあるので、定数式でない初期化子は宣言の位置で実行する文にする。
+// 変数名がレジスタ名と同じでも参照できるよう、アセンブリ上では生成したラベルで参照する
+func (p *TParser) globalVar(name *Token, ty *Type, thread bool) ([]*Node, error) {
+	if name.str == "main" {
+		return nil, p.errorAt(name, "%q redeclared as different kind of symbol", name.str)
+	}
+	gvar := &GVar{Label: p.newLabel("global." + name.str), Name: name.str, Type: ty, ThreadLocal: thread}
+	sym := &symbol{kind: symVar, gvar: gvar}
+	if ty.IsComplete() {
+		if err := p.declareSymbol(name, sym); err != nil {
+			return nil, err
+		}
+	}
+	var stmts []*Node
+	if p.consume("=") {
+		if !ty.IsComplete() && !(ty.Kind == TyArray && ty.Base.IsComplete()) {
+			return nil, p.errorAt(name, "variable %q has incomplete type", name.str)
+		}
+		init, err := p.initializer(ty)
+		if err != nil {
+			return nil, err
+		}
+		gvar.Type = alignedTo(init.ty, ty.Align)
+		buf := make([]byte, init.ty.Size)
+		if err := p.writeInitData(init, buf, 0); err == nil {
+			gvar.Init = buf
+		} else {
+			stmts = gvarInitializer(gvar, init)
+		}
+	} else if !ty.IsComplete() {
+		return nil, p.errorAt(name, "variable %q has incomplete type", name.str)
+	}
+	if !ty.IsComplete() {
+		if err := p.declareSymbol(name, sym); err != nil {
+			return nil, err
+		}
+	}
+	p.globals = append(p.globals, gvar)
+	return stmts, nil
+}
+
+// "extern" が付いた変数を宣言する。結合を持つ同じ名前の変数の宣言が見えていれば、その変数を指す。
+// 内部結合を持つ変数はそのまま内部結合になる。
+// そうでなければ、変数は他のオブジェクトファイルで定義されているものとして、名前をそのままラベルにする
+func (p *TParser) externDecl(name *Token, ty *Type, thread bool) error {
+	if p.token.kind == TKReserved && p.token.str == "=" {
+		return p.errorAt(p.token, "'extern' variable %q cannot have an initializer", name.str)
+	}
+	if sym := p.linkedSymbol(name.str); sym != nil && sym.gvar.Type.Kind != TyFunc {
+		if !isCompatible(sym.gvar.Type, ty) {
+			return p.errorAt(name, "conflicting types for %q", name.str)
+		}
+		if sym.gvar.ThreadLocal != thread {
+			return p.errorAt(name, "thread-local and non-thread-local declarations of %q", name.str)
+		}
+		return p.redeclareSymbol(name, sym)
+	}
+	gvar := &GVar{Label: name.str, Type: ty, Extern: true, ThreadLocal: thread}
+	if err := p.declareSymbol(name, &symbol{kind: symVar, gvar: gvar}); err != nil {
+		return err
+	}
+	p.globals = append(p.globals, gvar)
+	return nil
+}
+
+// 関数を宣言する。同じ名前の関数の宣言が見えていれば、互換な型であればその関数を指す。
+// 関数は他のオブジェクトファイルで定義されているものとして、名前をそのままラベルにする。
+// 内部結合の関数は定義できないので、"static" が付いた関数の宣言はエラーにする
+func (p *TParser) funcDecl(name *Token, ty *Type, class string, thread *Token, align int) error {
+	if class == "static" {
+		return p.errorAt(name, "static function %q is not supported because functions cannot be defined", name.str)
+	}
+	if thread != nil {
+		return p.errorAt(thread, "'%s' cannot be applied to function %q", thread.str, name.str)
+	}
+	if align > 0 {
+		return p.errorAt(name, "'_Alignas' attribute cannot be applied to function %q", name.str)
+	}
+	if p.token.kind == TKReserved && p.token.str == "=" {
+		return p.errorAt(p.token, "function %q cannot have an initializer", name.str)
+	}
+	if sym := p.linkedSymbol(name.str); sym != nil && sym.gvar.Type.Kind == TyFunc {
+		if !isCompatible(sym.gvar.Type, ty) {
+			return p.errorAt(name, "conflicting types for %q", name.str)
+		}
+		return p.redeclareSymbol(name, sym)
+	}
+	gvar := &GVar{Label: name.str, Type: ty, Extern: true}
+	return p.declareSymbol(name, &symbol{kind: symVar, gvar: gvar})
+}
+
+// 見えている名前nameの宣言が、結合を持つ変数か関数の宣言であればそのsymbolを返す。
+// 結合を持つのは、プログラムの最上位で宣言された変数と、externが付いた変数と、関数
+func (p *TParser) linkedSymbol(name string) *symbol {
+	sym := p.findSymbol(name)
+	if sym == nil || sym.gvar == nil {
+		return nil
+	}
+	if sym.gvar.Extern || sym.gvar.Type.Kind == TyFunc || p.scopes[0].symbols[name] == sym {
+		return sym
+	}
+	return nil
+}
+
+// 宣言済みのsymを、同じ名前の宣言として現在のスコープから見えるようにする。現在のスコープで宣言済みであれば何もしない
+func (p *TParser) redeclareSymbol(name *Token, sym *symbol) error {
+	if p.curScope().symbols[name.str] == sym {
+		return nil
+	}
+	return p.declareSymbol(name, sym)
+}
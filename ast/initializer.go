@@ -0,0 +1,442 @@
+package ast
+
+import (
+	"math"
+
+	"golang.org/x/xerrors"
+)
+
+// initializer は、初期化子をparseした結果を、初期化される変数の型の構造に沿って保持する
+type initializer struct {
+	ty       *Type
+	expr     *Node          // 初期化式。スカラー型と、式で初期化される構造体・共用体に使う
+	tok      *Token         // 初期化式の先頭のトークン。エラー表示に使う
+	children []*initializer // 配列の要素、または構造体・共用体のメンバーの初期化子
+	flexible bool           // 要素数を省略した配列であるときtrue。要素の初期化子は必要に応じて追加する
+}
+
+// 型tyの変数の初期化子を作る。flexibleがtrueのとき、要素数を省略した配列型を受け付ける
+func newInitializer(ty *Type, flexible bool) *initializer {
+	init := &initializer{ty: ty}
+	switch {
+	case ty.Kind == TyArray && flexible && !ty.IsComplete():
+		init.flexible = true
+	case ty.Kind == TyArray:
+		for i := 0; i < ty.ArrayLen; i++ {
+			init.children = append(init.children, newInitializer(ty.Base, false))
+		}
+	case ty.IsAggregate():
+		for _, m := range ty.Members {
+			init.children = append(init.children, newInitializer(m.Type, false))
+		}
+	}
+	return init
+}
+
+// 配列の初期化子initのi番目の要素の初期化子を返す。要素数を省略した配列であれば必要なだけ要素を追加する
+func (init *initializer) element(i int) *initializer {
+	for init.flexible && len(init.children) <= i {
+		init.children = append(init.children, newInitializer(init.ty.Base, false))
+	}
+	return init.children[i]
+}
+
+// 共用体の初期化子initのi番目のメンバーを初期化する。共用体は最後に初期化されたメンバーの値だけを持つ
+func (init *initializer) unionMember(i int) *initializer {
+	for j, m := range init.ty.Members {
+		if j != i {
+			init.children[j] = newInitializer(m.Type, false)
+		}
+	}
+	return init.children[i]
+}
+
+// 型tyの変数の初期化子をparseする。要素数を省略した配列型の場合、初期化子の要素数から型を決める
+func (p *TParser) initializer(ty *Type) (*initializer, error) {
+	if ty.Kind == TyArray && !(p.token.kind == TKReserved && p.token.str == "{") {
+		return nil, p.errorAt(p.token, "array initializer must be an initializer list")
+	}
+	init := newInitializer(ty, true)
+	if err := p.parseInitializer(init); err != nil {
+		return nil, err
+	}
+	if init.flexible {
+		init.ty = ArrayOf(ty.Base, len(init.children))
+	}
+	return init, nil
+}
+
+// initializer = "{" (designation? initializer ("," designation? initializer)*)? ","? "}" | assign
+//
+// 集成体の要素の初期化子は、波括弧を省略して並べて書くこともできる
+func (p *TParser) parseInitializer(init *initializer) error {
+	if init.ty.Kind == TyArray {
+		if p.consume("{") {
+			return p.arrayInitializer(init)
+		}
+		return p.elidedInitializer(init, 0)
+	}
+	if p.consume("{") {
+		if init.ty.IsAggregate() {
+			return p.structInitializer(init)
+		}
+		// スカラーの初期化子も波括弧で囲める
+		if err := p.parseInitializer(init); err != nil {
+			return err
+		}
+		p.consume(",")
+		return p.expect("}")
+	}
+	// 式は一度だけparseする。式の中の文式や複合リテラルが宣言する変数やラベルを重複して登録しないため
+	tok := p.token
+	expr, err := p.assign()
+	if err != nil {
+		return xerrors.Errorf("failed to parse initializer. cause:\n%w", err)
+	}
+	return p.exprInitializer(init, expr, tok)
+}
+
+// 初期化子initを、parse済みの初期化式exprで初期化する。tokはexprの先頭のトークン。
+// initが集成体でexprと同じ型でなければ、exprは波括弧を省略した先頭の要素の初期化式になり、
+// 残りの要素の初期化子は続けてparseする
+func (p *TParser) exprInitializer(init *initializer, expr *Node, tok *Token) error {
+	if init.ty.Kind != TyArray && !init.ty.IsAggregate() {
+		if err := p.checkAssignable(tok, init.ty, typeOf(expr)); err != nil {
+			return err
+		}
+		init.expr, init.tok = expr, tok
+		return nil
+	}
+	if init.ty.IsAggregate() && typeOf(expr).Unqualified() == init.ty.Unqualified() {
+		init.expr, init.tok = expr, tok
+		return nil
+	}
+	if len(init.children) == 0 {
+		return p.errorAt(tok, "excess elements in %s initializer", init.ty.Kind)
+	}
+	if err := p.exprInitializer(p.memberInitializer(init, 0), expr, tok); err != nil {
+		return err
+	}
+	return p.elidedInitializer(init, 1)
+}
+
+// "{" の直後から配列の初期化子をparseする
+func (p *TParser) arrayInitializer(init *initializer) error {
+	for i, first := 0, true; !p.consume("}"); first = false {
+		if !first {
+			if err := p.expect(","); err != nil {
+				return xerrors.Errorf("failed to parse array initializer. cause:\n%w", err)
+			}
+			if p.consume("}") {
+				break
+			}
+		}
+		if tok := p.token; p.consume("[") {
+			idx, err := p.arrayDesignator(init, tok)
+			if err != nil {
+				return err
+			}
+			if err := p.designation(init.element(idx)); err != nil {
+				return err
+			}
+			i = idx + 1
+			continue
+		}
+		if !init.flexible && i >= len(init.children) {
+			return p.errorAt(p.token, "excess elements in array initializer")
+		}
+		if err := p.parseInitializer(init.element(i)); err != nil {
+			return err
+		}
+		i++
+	}
+	return nil
+}
+
+// "{" の直後から構造体または共用体の初期化子をparseする。共用体は先頭のメンバーを初期化する
+func (p *TParser) structInitializer(init *initializer) error {
+	limit := len(init.children)
+	if init.ty.Kind == TyUnion {
+		limit = 1
+	}
+	for i, first := 0, true; !p.consume("}"); first = false {
+		if !first {
+			if err := p.expect(","); err != nil {
+				return xerrors.Errorf("failed to parse %s initializer. cause:\n%w", init.ty.Kind, err)
+			}
+			if p.consume("}") {
+				break
+			}
+		}
+		if p.consume(".") {
+			idx, err := p.memberDesignator(init)
+			if err != nil {
+				return err
+			}
+			if err := p.designation(p.memberInitializer(init, idx)); err != nil {
+				return err
+			}
+			i = idx + 1
+			continue
+		}
+		if i >= limit {
+			return p.errorAt(p.token, "excess elements in %s initializer", init.ty.Kind)
+		}
+		if err := p.parseInitializer(p.memberInitializer(init, i)); err != nil {
+			return err
+		}
+		i++
+	}
+	return nil
+}
+
+// 配列・構造体・共用体の初期化子initのi番目の要素の初期化子を返す
+func (p *TParser) memberInitializer(init *initializer, i int) *initializer {
+	if init.ty.Kind == TyUnion {
+		return init.unionMember(i)
+	}
+	return init.children[i]
+}
+
+// 波括弧を省略した配列・構造体・共用体の初期化子として、start番目以降の要素の初期化子をparseする。
+// 共用体は先頭のメンバーだけを初期化する。
+// リストの終わりか指示子が現れたら、残りの要素は外側の初期化子に任せる
+func (p *TParser) elidedInitializer(init *initializer, start int) error {
+	limit := len(init.children)
+	if init.ty.Kind == TyUnion {
+		limit = 1
+	}
+	for i := start; i < limit; i++ {
+		if i > 0 {
+			if !p.continuesList() {
+				return nil
+			}
+			p.consume(",")
+		}
+		if err := p.parseInitializer(p.memberInitializer(init, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 現在のトークンが "," で、その後に指示子を伴わない初期化子が続くときtrueを返す
+func (p *TParser) continuesList() bool {
+	if p.token.kind != TKReserved || p.token.str != "," {
+		return false
+	}
+	next := p.token.next
+	return !(next.kind == TKReserved && (next.str == "}" || next.str == "[" || next.str == "."))
+}
+
+// designation = ("[" equality "]" | "." ident)* "=" initializer
+//
+// 最初の指示子を読んだ後から、残りの指示子と初期化子をparseする
+func (p *TParser) designation(init *initializer) error {
+	if tok := p.token; p.consume("[") {
+		if init.ty.Kind != TyArray {
+			return p.errorAt(tok, "array designator cannot initialize non-array type %s", init.ty.Kind)
+		}
+		idx, err := p.arrayDesignator(init, tok)
+		if err != nil {
+			return err
+		}
+		return p.designation(init.element(idx))
+	}
+	if tok := p.token; p.consume(".") {
+		if !init.ty.IsAggregate() {
+			return p.errorAt(tok, "field designator cannot initialize a non-struct, non-union type %s", init.ty.Kind)
+		}
+		idx, err := p.memberDesignator(init)
+		if err != nil {
+			return err
+		}
+		return p.designation(p.memberInitializer(init, idx))
+	}
+	if err := p.expect("="); err != nil {
+		return xerrors.Errorf("failed to parse designation. cause:\n%w", err)
+	}
+	return p.parseInitializer(init)
+}
+
+// "[" の直後から配列の指示子の "[" equality "]" をparseし、添字を返す。tokはエラー表示に使う
+func (p *TParser) arrayDesignator(init *initializer, tok *Token) (int, error) {
+	idx, err := p.constExpr()
+	if err != nil {
+		return 0, p.errorAt(tok, "array designator is not an integer constant: %v", err)
+	}
+	if idx < 0 || !init.flexible && idx >= len(init.children) {
+		return 0, p.errorAt(tok, "array designator index %d exceeds array bounds", idx)
+	}
+	if err := p.expect("]"); err != nil {
+		return 0, xerrors.Errorf("failed to parse array designator. cause:\n%w", err)
+	}
+	return idx, nil
+}
+
+// "." の直後から構造体または共用体の指示子のメンバー名をparseし、メンバーの番号を返す
+func (p *TParser) memberDesignator(init *initializer) (int, error) {
+	name := p.token
+	if name.kind != TKIDENT {
+		return 0, p.errorAt(name, "expect field name but got %q", name.str)
+	}
+	for i, m := range init.ty.Members {
+		if m.Name == name.str {
+			p.token = p.token.next
+			p.pos++
+			return i, nil
+		}
+	}
+	return 0, p.errorAt(name, "field designator %q does not refer to any field in %s", name.str, init.ty.Kind)
+}
+
+// objectAt は、初期化する変数の先頭からoffsetバイトの位置にある型tyのオブジェクトを表すNodeを返す
+type objectAt func(offset int, ty *Type) *Node
+
+// ローカル変数lvarを初期化子initに従って初期化する文を返す
+func lvarInitializer(lvar *LVar, init *initializer) []*Node {
+	return varInitializer(func(offset int, ty *Type) *Node { return lvarAt(lvar, offset, ty) }, init)
+}
+
+// 静的記憶域期間を持つ変数gvarを初期化子initに従って初期化する文を返す
+func gvarInitializer(gvar *GVar, init *initializer) []*Node {
+	return varInitializer(func(offset int, ty *Type) *Node { return gvarAt(gvar, offset, ty) }, init)
+}
+
+// atで表される変数を初期化子initに従って初期化する文を返す。
+// 配列・構造体・共用体は、初期化子が指定されなかった要素が0になるよう先に全体を0で埋める
+func varInitializer(at objectAt, init *initializer) []*Node {
+	var result []*Node
+	if init.ty.Kind == TyArray || init.ty.IsAggregate() {
+		result = append(result, &Node{Kind: MemZero, Lhs: at(0, init.ty)})
+	}
+	return append(result, initAssigns(at, init, 0)...)
+}
+
+// atで表される変数の先頭からoffsetバイトの位置にある、初期化子initに対応するオブジェクトへの代入式を返す
+func initAssigns(at objectAt, init *initializer, offset int) []*Node {
+	if init.expr != nil {
+		return []*Node{NewNode(Assign, at(offset, init.ty), init.expr)}
+	}
+	var result []*Node
+	for i, child := range init.children {
+		if init.ty.Kind == TyArray {
+			result = append(result, initAssigns(at, child, offset+i*init.ty.Base.Size)...)
+			continue
+		}
+		m := init.ty.Members[i]
+		if m.IsBitfield { // ビットフィールドは格納単位の他のビットを壊さないよう、メンバーアクセスを通して代入する
+			if child.expr != nil {
+				member := &Node{Kind: MemberAccess, Lhs: at(offset, init.ty), Member: m, Type: m.Type}
+				result = append(result, NewNode(Assign, member, child.expr))
+			}
+			continue
+		}
+		result = append(result, initAssigns(at, child, offset+m.Offset)...)
+	}
+	return result
+}
+
+// lvarの先頭からoffsetバイトの位置にある型tyのオブジェクトを表すNodeを返す
+func lvarAt(lvar *LVar, offset int, ty *Type) *Node {
+	return &Node{
+		Kind:   LocalVar,
+		Name:   lvar.name,
+		Offset: lvar.offset - offset, // ローカル変数のアドレスは rbp - Offset
+		Type:   ty,
+	}
+}
+
+// gvarの先頭からoffsetバイトの位置にある型tyのオブジェクトを表すNodeを返す
+func gvarAt(gvar *GVar, offset int, ty *Type) *Node {
+	return &Node{
+		Kind:   GlobalVar,
+		Offset: offset, // 静的記憶域期間を持つ変数のアドレスは ラベル + Offset
+		Type:   ty,
+		Var:    gvar,
+	}
+}
+
+// 初期化子initの値を、静的記憶域期間を持つ変数の初期値のバイト列bufのoffsetバイト目から書き込む。
+// 初期化式はコンパイル時に値が決まる算術型の定数式でなければならない
+func (p *TParser) writeInitData(init *initializer, buf []byte, offset int) error {
+	if init.expr == nil {
+		for i, child := range init.children {
+			if init.ty.Kind == TyArray {
+				if err := p.writeInitData(child, buf, offset+i*init.ty.Base.Size); err != nil {
+					return err
+				}
+				continue
+			}
+			m := init.ty.Members[i]
+			if m.IsBitfield {
+				if err := p.writeBitfieldData(child, m, buf, offset+m.Offset); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := p.writeInitData(child, buf, offset+m.Offset); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if init.ty.IsAggregate() {
+		return p.errorAt(init.tok, "initializer element is not a compile-time constant")
+	}
+	bits, err := p.initBits(init)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < init.ty.Size; i++ { // リトルエンディアンで書き込む
+		buf[offset+i] = byte(bits >> (8 * i))
+	}
+	return nil
+}
+
+// ビットフィールドのメンバーmの初期化子initの値を、bufのoffsetバイト目から始まる格納単位に書き込む。
+// 格納単位の他のビットは他のメンバーの値なので残しておく
+func (p *TParser) writeBitfieldData(init *initializer, m *Member, buf []byte, offset int) error {
+	if init.expr == nil {
+		return nil
+	}
+	bits, err := p.initBits(init)
+	if err != nil {
+		return err
+	}
+	bits = (bits & (1<<uint(m.BitWidth) - 1)) << uint(m.BitOffset)
+	for i := 0; i < m.Type.Size; i++ {
+		buf[offset+i] |= byte(bits >> (8 * i))
+	}
+	return nil
+}
+
+// スカラー型の初期化子initの初期化式をコンパイル時に評価し、その値のビット列を返す
+func (p *TParser) initBits(init *initializer) (uint64, error) {
+	var bits uint64
+	switch from := typeOf(init.expr); {
+	case init.ty.IsFlonum():
+		v, err := evalFloat(init.expr)
+		if err != nil {
+			return 0, p.errorAt(init.tok, "initializer element is not a compile-time constant: %v", err)
+		}
+		if init.ty.Kind == TyFloat {
+			bits = uint64(math.Float32bits(float32(v)))
+		} else {
+			bits = math.Float64bits(v)
+		}
+	case from.IsFlonum():
+		v, err := evalFloat(init.expr)
+		if err != nil {
+			return 0, p.errorAt(init.tok, "initializer element is not a compile-time constant: %v", err)
+		}
+		bits = uint64(floatToInt(v, init.ty))
+	default:
+		v, err := eval(init.expr)
+		if err != nil {
+			return 0, p.errorAt(init.tok, "initializer element is not a compile-time constant: %v", err)
+		}
+		bits = uint64(truncateInt(v, init.ty))
+	}
+	return bits, nil
+}
@@ -2,33 +2,73 @@ package ast
 
 // Node represents AST node
 type Node struct {
-	Value int    // only used when Kind = Num
-	Name  string // only used when Kind = LocalVar
+	Value int     // only used when Kind = Num, Case, Atomic*
+	FVal  float64 // 浮動小数点数の値. only used when Kind = Num and Type is float or double
+	Name  string  // only used when Kind = LocalVar, Goto, Label
 	// TODO: delete Name field (全ての変数のoffsetはあらかじめ決めておくので名前は必要ないけどデバッグ用に残しておく)
 	Kind
-	Lhs    *Node
-	Rhs    *Node
-	Offset int // only used when Kind = LocalVar
+	Lhs       *Node
+	Rhs       *Node
+	Offset    int     // only used when Kind = LocalVar, GlobalVar
+	Label     string  // アセンブリ上のラベル. only used when Kind = Goto, Label, Break, Continue, Switch, Case, Default, DoWhile
+	ContLabel string  // continueのジャンプ先ラベル. only used when Kind = DoWhile
+	Body      []*Node // only used when Kind = Block, StmtExpr, AtomicCAS, Call
+	Cases     []*Node // switch文に含まれるKind = Case, Defaultのノード. only used when Kind = Switch
+	Type      *Type   // 式の型. parse時またはAddTypeによって設定される
+	Member    *Member // only used when Kind = MemberAccess
+	Var       *GVar   // only used when Kind = GlobalVar
+	Asm       *Asm    // only used when Kind = AsmStmt
 }
 
 // Kind represents kind of a node
 type Kind string
 
 const (
-	Num      Kind = "Num"
-	Add      Kind = "Add"
-	Sub      Kind = "Sub"
-	Mul      Kind = "Mul"
-	Div      Kind = "Div"
-	Eq       Kind = "Equality"
-	Neq      Kind = "NonEquality"
-	LT       Kind = "LessThan"
-	GT       Kind = "GreaterThan"
-	LE       Kind = "LessThanOrEqual"
-	GE       Kind = "GreaterThanOrEqual"
-	Assign   Kind = "Assignment"
-	LocalVar Kind = "Identifier"
-	Return   Kind = "Return"
+	Num          Kind = "Num"
+	Add          Kind = "Add"
+	Sub          Kind = "Sub"
+	Mul          Kind = "Mul"
+	Div          Kind = "Div"
+	Eq           Kind = "Equality"
+	Neq          Kind = "NonEquality"
+	LT           Kind = "LessThan"
+	GT           Kind = "GreaterThan"
+	LE           Kind = "LessThanOrEqual"
+	GE           Kind = "GreaterThanOrEqual"
+	Assign       Kind = "Assignment"
+	LocalVar     Kind = "Identifier"
+	GlobalVar    Kind = "GlobalVariable" // 静的記憶域期間を持つ変数。ラベルで参照する
+	Return       Kind = "Return"
+	Goto         Kind = "Goto"
+	Label        Kind = "Label" // Nameをラベル名とし、Lhsの文にラベルを付ける
+	Break        Kind = "Break"
+	Continue     Kind = "Continue"
+	Block        Kind = "Block"
+	Switch       Kind = "Switch"       // Lhsの値によってRhsの文の中のcaseラベルへジャンプする. LabelはSwitchを抜けるときのジャンプ先
+	Case         Kind = "Case"         // Valueをcaseの値とし、Lhsの文にラベルを付ける
+	Default      Kind = "Default"      // Lhsの文にdefaultラベルを付ける
+	DoWhile      Kind = "DoWhile"      // Lhsの文をRhsの値が0になるまで繰り返す. Labelはループをぬけるときのジャンプ先
+	Addr         Kind = "Address"      // &Lhs
+	Deref        Kind = "Dereference"  // *Lhs
+	MemberAccess Kind = "MemberAccess" // Lhs.Member
+	Cast         Kind = "Cast"         // Lhsの値をTypeに変換する
+	Neg          Kind = "Negation"     // 浮動小数点数の-Lhs. 整数の単項-は0-Lhsで表す
+	MemZero      Kind = "MemZero"      // Lhsの変数の領域を0で埋める
+	Comma        Kind = "Comma"        // Lhsの文を実行した後、Rhsの値を式の値とする
+	StmtExpr     Kind = "StmtExpr"     // Bodyの文を順に実行し、最後の式文の値を式の値とする. 最後の文が式文でなければ値を持たない
+	AsmStmt      Kind = "AsmStmt"      // Asmの命令をそのまま出力する
+	Call         Kind = "Call"         // Lhsの関数をBodyの実引数で呼び出す. Lhsは関数または関数へのポインタ
+)
+
+// アトミック操作の組み込み関数。Lhsは操作するオブジェクトを指すポインタで、Valueはメモリオーダー
+const (
+	AtomicLoad     Kind = "AtomicLoad"     // Lhsの指す先の値を読み出す
+	AtomicStore    Kind = "AtomicStore"    // Lhsの指す先にRhsの値を書き込む
+	AtomicExchange Kind = "AtomicExchange" // Lhsの指す先にRhsの値を書き込み、元の値を式の値とする
+	AtomicCAS      Kind = "AtomicCAS"      // Lhsの指す先の値がBody[0]の指す先の値と等しければRhsの値に置き換え、等しくなければBody[0]の指す先に読み出す
+	AtomicFetchAdd Kind = "AtomicFetchAdd" // Lhsの指す先の値にRhsの値を足し、元の値を式の値とする
+	AtomicFetchSub Kind = "AtomicFetchSub" // Lhsの指す先の値からRhsの値を引き、元の値を式の値とする
+	AtomicFence    Kind = "AtomicFence"    // メモリフェンス。Lhsは使わない
 )
 
 func NewNode(k Kind, lhs, rhs *Node) *Node {
@@ -0,0 +1,477 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// マクロの定義
+type macro struct {
+	name     string
+	funcLike bool     // 関数形式マクロであるときtrue
+	params   []string // 関数形式マクロの仮引数の名前
+	variadic bool     // 可変個の引数を__VA_ARGS__で受け取るときtrue
+	body     []*Token // 置換リスト
+	builtin  bool     // ソースコードの外で定義された定義済みマクロであるときtrue
+}
+
+// 定義済みマクロの名前と置換リスト。#includeがないので、<stdbool.h>のマクロを最初から定義しておく
+var builtinMacros = map[string]string{
+	"bool":  "_Bool",
+	"true":  "1",
+	"false": "0",
+}
+
+// hideset は、トークンがその展開によって生成されたマクロの名前の集合。
+// 集合に含まれるマクロはそのトークンから再び展開しないので、再帰的なマクロの展開が止まる
+type hideset map[string]bool
+
+// union は、hsにnameを加えた集合を返す。hsは変更しない
+func (hs hideset) union(name string) hideset {
+	u := hideset{name: true}
+	for n := range hs {
+		u[n] = true
+	}
+	return u
+}
+
+// intersection は、hsとotherの両方に含まれる名前の集合を返す
+func (hs hideset) intersection(other hideset) hideset {
+	i := hideset{}
+	for n := range hs {
+		if other[n] {
+			i[n] = true
+		}
+	}
+	return i
+}
+
+// プリプロセッサの状態
+type preprocessor struct {
+	src    []rune // エラー表示に使うソースコード
+	macros map[string]*macro
+}
+
+// preprocess は、srcをtokenizeしたトークン列tokの前処理指令を実行し、マクロを展開したトークン列を返す
+func preprocess(src string, tok *Token) (*Token, error) {
+	pp := &preprocessor{src: []rune(src), macros: make(map[string]*macro)}
+	if err := pp.defineBuiltins(); err != nil {
+		return nil, err
+	}
+	markSpaces(pp.src, tok)
+	head := new(Token)
+	cur := head
+	for tok.kind != TKEOF {
+		if tok.bol && tok.kind == TKReserved && tok.str == "#" {
+			next, err := pp.directive(tok.next)
+			if err != nil {
+				return nil, err
+			}
+			tok = next
+			continue
+		}
+		next, ok, err := pp.expand(tok)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			tok = next
+			continue
+		}
+		cur.next = tok
+		cur = tok
+		tok = tok.next
+	}
+	cur.next = tok
+	return head.next, nil
+}
+
+// 定義済みマクロを定義する
+func (pp *preprocessor) defineBuiltins() error {
+	for name, src := range builtinMacros {
+		tok, err := tokenize(src)
+		if err != nil {
+			return xerrors.Errorf("failed to define builtin macro %q. cause:\n%w", name, err)
+		}
+		var body []*Token
+		for ; tok.kind != TKEOF; tok = tok.next {
+			body = append(body, tok)
+		}
+		pp.macros[name] = &macro{name: name, body: body, builtin: true}
+	}
+	return nil
+}
+
+// 各トークンに、直前に空白があるかどうかと行の最初のトークンであるかどうかを設定する。
+// バックスラッシュの直後の改行は行の区切りとみなさない
+func markSpaces(src []rune, tok *Token) {
+	end := 0 // 直前のトークンの終わりの位置
+	for t := tok; t != nil; t = t.next {
+		between := src[end:t.pos]
+		t.space = len(between) > 0
+		t.bol = end == 0
+		for i, r := range between {
+			if r == '\n' && (i == 0 || between[i-1] != '\\') {
+				t.bol = true
+			}
+		}
+		end = t.pos + len([]rune(t.str))
+	}
+}
+
+// エラー表示の位置を付けたエラーを返す
+func (pp *preprocessor) errorAt(tok *Token, format string, a ...interface{}) error {
+	return xerrors.Errorf("%s: %s", position(pp.src, tok.pos), fmt.Sprintf(format, a...))
+}
+
+// tokが識別子と同じ形のトークン(予約語を含む)であるときtrueを返す。マクロの名前には予約語も使える
+func isIdentLike(tok *Token) bool {
+	return tok.kind == TKIDENT || tok.kind == TKReturn || tok.kind == TKReserved && keywords[tok.str]
+}
+
+// 行の終わりまでのトークンを読み、次の行の最初のトークンを返す
+func skipLine(tok *Token) ([]*Token, *Token) {
+	var line []*Token
+	for ; tok.kind != TKEOF && !tok.bol; tok = tok.next {
+		line = append(line, tok)
+	}
+	return line, tok
+}
+
+// directive = "#" ("define" ident ("(" params? ")")? tokens | "undef" ident)?
+//
+// 行頭の "#" の直後から前処理指令を実行し、次の行の最初のトークンを返す。"#" だけの行は何もしない
+func (pp *preprocessor) directive(tok *Token) (*Token, error) {
+	if tok.kind == TKEOF || tok.bol {
+		return tok, nil
+	}
+	name := tok.str
+	line, next := skipLine(tok.next)
+	switch name {
+	case "define":
+		if err := pp.define(tok, line); err != nil {
+			return nil, err
+		}
+	case "undef":
+		if len(line) == 0 || !isIdentLike(line[0]) {
+			return nil, pp.errorAt(tok, "macro name missing")
+		}
+		if len(line) > 1 {
+			return nil, pp.errorAt(line[1], "extra tokens at end of #undef directive")
+		}
+		delete(pp.macros, line[0].str)
+	default:
+		return nil, pp.errorAt(tok, "invalid preprocessing directive #%s", name)
+	}
+	return next, nil
+}
+
+// "#define" に続く行のトークンlineからマクロを定義する。tokは "define" のトークンで、エラー表示に使う。
+// マクロの名前の直後に空白を挟まずに "(" が続けば関数形式マクロになる
+func (pp *preprocessor) define(tok *Token, line []*Token) error {
+	if len(line) == 0 || !isIdentLike(line[0]) {
+		return pp.errorAt(tok, "macro name missing")
+	}
+	m := &macro{name: line[0].str}
+	body := line[1:]
+	if len(body) > 0 && body[0].str == "(" && !body[0].space {
+		m.funcLike = true
+		rest, err := pp.macroParams(m, body[0], body[1:])
+		if err != nil {
+			return err
+		}
+		body = rest
+	}
+	for i, t := range body {
+		switch {
+		case t.kind == TKReserved && t.str == "##" && (i == 0 || i == len(body)-1):
+			return pp.errorAt(t, "'##' cannot appear at either end of a macro expansion")
+		case m.funcLike && t.kind == TKReserved && t.str == "#" && (i == len(body)-1 || m.param(body[i+1]) < 0):
+			return pp.errorAt(t, "'#' is not followed by a macro parameter")
+		case t.kind == TKIDENT && t.str == "__VA_ARGS__" && !m.variadic:
+			return pp.errorAt(t, "__VA_ARGS__ can only appear in the expansion of a variadic macro")
+		}
+	}
+	m.body = body
+	pp.macros[m.name] = m
+	return nil
+}
+
+// params = (ident ("," ident)* ("," "...")? | "...")
+//
+// 関数形式マクロmの仮引数の並びを "(" の直後からparseし、")" より後ろの置換リストを返す。lparenは "(" のトークン
+func (pp *preprocessor) macroParams(m *macro, lparen *Token, toks []*Token) ([]*Token, error) {
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		if len(m.params) == 0 && !m.variadic && t.str == ")" {
+			return toks[i+1:], nil
+		}
+		if t.kind == TKReserved && t.str == "..." {
+			m.variadic = true
+			if i+1 < len(toks) && toks[i+1].str == ")" {
+				return toks[i+2:], nil
+			}
+			return nil, pp.errorAt(t, "missing ')' in macro parameter list")
+		}
+		if !isIdentLike(t) || t.str == "__VA_ARGS__" {
+			return nil, pp.errorAt(t, "expected parameter name, found %q", t.str)
+		}
+		if m.param(t) >= 0 {
+			return nil, pp.errorAt(t, "duplicate macro parameter %q", t.str)
+		}
+		m.params = append(m.params, t.str)
+		if i+1 < len(toks) && toks[i+1].str == ")" {
+			return toks[i+2:], nil
+		}
+		if i+1 >= len(toks) || toks[i+1].str != "," {
+			break
+		}
+		i++
+	}
+	return nil, pp.errorAt(lparen, "missing ')' in macro parameter list")
+}
+
+// param は、トークンtが関数形式マクロmの仮引数であればその番号を返す。__VA_ARGS__は最後の仮引数の次の番号になる。
+// 仮引数でなければ-1を返す
+func (m *macro) param(t *Token) int {
+	if !isIdentLike(t) {
+		return -1
+	}
+	for i, p := range m.params {
+		if p == t.str {
+			return i
+		}
+	}
+	if m.variadic && t.str == "__VA_ARGS__" {
+		return len(m.params)
+	}
+	return -1
+}
+
+// トークンtokがマクロの名前であれば展開し、展開したトークン列の先頭を返す。
+// 展開したトークン列は再び走査され、その中のマクロも展開される。tokを展開しなかった場合はokがfalseになる
+func (pp *preprocessor) expand(tok *Token) (*Token, bool, error) {
+	m := pp.macros[tok.str]
+	if !isIdentLike(tok) || m == nil || tok.hideset[tok.str] {
+		return nil, false, nil
+	}
+	if !m.funcLike {
+		body, err := pp.substitute(m, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		next := pp.link(tok, body, tok.hideset.union(m.name), tok.next)
+		if m.builtin { // 定義済みマクロの置換リストはソースコードの中にないので、展開したトークンの位置はマクロを使った位置にする
+			for t := next; t != tok.next; t = t.next {
+				t.pos = tok.pos
+			}
+		}
+		return next, true, nil
+	}
+	// 関数形式マクロの名前は、"(" が続くときだけ展開する
+	if tok.next.kind != TKReserved || tok.next.str != "(" {
+		return nil, false, nil
+	}
+	args, rparen, err := pp.macroArgs(tok, m)
+	if err != nil {
+		return nil, false, err
+	}
+	body, err := pp.substitute(m, args)
+	if err != nil {
+		return nil, false, err
+	}
+	hs := tok.hideset.intersection(rparen.hideset).union(m.name)
+	return pp.link(tok, body, hs, rparen.next), true, nil
+}
+
+// トークン列toksのコピーを、隠す名前の集合hsを加えてrestの前につなげたトークン列を返す。
+// 先頭のトークンは展開したマクロの名前tokの前の空白を引き継ぐ
+func (pp *preprocessor) link(tok *Token, toks []*Token, hs hideset, rest *Token) *Token {
+	head := new(Token)
+	cur := head
+	for i, t := range toks {
+		c := *t
+		c.bol = false
+		c.hideset = hs
+		for n := range t.hideset {
+			c.hideset = c.hideset.union(n)
+		}
+		if i == 0 {
+			c.space = tok.space
+		}
+		cur.next = &c
+		cur = &c
+	}
+	cur.next = rest
+	return head.next
+}
+
+// 関数形式マクロmの名前tokに続く実引数を読み、各実引数のトークン列と ")" のトークンを返す。
+// 実引数は括弧の外の "," で区切り、可変個の実引数は "," も含めて1つの実引数にまとめる
+func (pp *preprocessor) macroArgs(tok *Token, m *macro) ([][]*Token, *Token, error) {
+	var args [][]*Token
+	var arg []*Token
+	depth := 0
+	for t := tok.next.next; t.kind != TKEOF; t = t.next {
+		if t.kind == TKReserved {
+			switch {
+			case t.str == "(":
+				depth++
+			case t.str == ")" && depth > 0:
+				depth--
+			case t.str == ")":
+				args = append(args, arg)
+				return args, t, pp.checkArgCount(tok, m, args)
+			case t.str == "," && depth == 0 && !(m.variadic && len(args) == len(m.params)):
+				args = append(args, arg)
+				arg = nil
+				continue
+			}
+		}
+		arg = append(arg, t)
+	}
+	return nil, nil, pp.errorAt(tok, "unterminated argument list invoking macro %q", m.name)
+}
+
+// 関数形式マクロmに渡された実引数argsの個数を確かめる。
+// 仮引数のないマクロの空の実引数と、省略された可変個の実引数は0個として扱う
+func (pp *preprocessor) checkArgCount(tok *Token, m *macro, args [][]*Token) error {
+	n := len(args)
+	if len(m.params) == 0 && n == 1 && len(args[0]) == 0 {
+		n = 0
+	}
+	switch {
+	case n < len(m.params):
+		return pp.errorAt(tok, "macro %q requires %d arguments, but only %d given", m.name, len(m.params), n)
+	case n > len(m.params) && !m.variadic:
+		return pp.errorAt(tok, "macro %q passed %d arguments, but takes just %d", m.name, n, len(m.params))
+	}
+	return nil
+}
+
+// マクロmの置換リストの仮引数を実引数argsで置き換え、"##" で連結したトークン列を返す。
+// "#" と "##" の被演算子になる仮引数は実引数をそのまま使い、それ以外の仮引数は実引数のマクロを展開してから置き換える
+func (pp *preprocessor) substitute(m *macro, args [][]*Token) ([]*Token, error) {
+	arg := func(t *Token) []*Token {
+		if i := m.param(t); i >= 0 && i < len(args) {
+			return args[i]
+		}
+		return nil // 省略された可変個の実引数
+	}
+	isPaste := func(i int) bool {
+		return i < len(m.body) && m.body[i].kind == TKReserved && m.body[i].str == "##"
+	}
+	var result []*Token
+	placemarker := false // 直前の仮引数が空の実引数に置き換わったときtrue
+	for i := 0; i < len(m.body); i++ {
+		t := m.body[i]
+		switch {
+		case m.funcLike && t.kind == TKReserved && t.str == "#":
+			result = append(result, pp.stringize(t, arg(m.body[i+1])))
+			i++
+			placemarker = false
+		case isPaste(i):
+			rhs := m.body[i+1]
+			i++
+			toks := []*Token{rhs}
+			if m.param(rhs) >= 0 {
+				toks = arg(rhs)
+			}
+			switch {
+			case placemarker:
+				// 空の実引数と連結すると、もう一方の被演算子がそのまま残る
+			case rhs.str == "__VA_ARGS__" && result[len(result)-1].str == ",":
+				// GNU拡張の ", ## __VA_ARGS__" は、可変個の実引数が空であれば "," を取り除く
+				if len(toks) == 0 {
+					result = result[:len(result)-1]
+				}
+			case len(toks) > 0:
+				pasted, err := pp.paste(result[len(result)-1], toks[0])
+				if err != nil {
+					return nil, err
+				}
+				result[len(result)-1] = pasted
+				toks = toks[1:]
+			}
+			result = append(result, toks...)
+			placemarker = placemarker && len(toks) == 0
+		case m.param(t) >= 0 && isPaste(i+1):
+			toks := arg(t)
+			result = append(result, toks...)
+			placemarker = len(toks) == 0
+		case m.param(t) >= 0:
+			expanded, err := pp.expandArg(arg(t))
+			if err != nil {
+				return nil, err
+			}
+			if len(expanded) > 0 {
+				first := *expanded[0]
+				first.space = t.space
+				expanded[0] = &first
+			}
+			result = append(result, expanded...)
+			placemarker = false
+		default:
+			result = append(result, t)
+			placemarker = false
+		}
+	}
+	return result, nil
+}
+
+// 実引数のトークン列toksの中のマクロを全て展開したトークン列を返す
+func (pp *preprocessor) expandArg(toks []*Token) ([]*Token, error) {
+	eof := &Token{kind: TKEOF}
+	var tok *Token = eof
+	for i := len(toks) - 1; i >= 0; i-- {
+		c := *toks[i]
+		c.next = tok
+		tok = &c
+	}
+	var result []*Token
+	for tok != eof {
+		next, ok, err := pp.expand(tok)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			tok = next
+			continue
+		}
+		result = append(result, tok)
+		tok = tok.next
+	}
+	return result, nil
+}
+
+// "#" 演算子で、実引数のトークン列toksの綴りを文字列リテラルにする。hashは "#" のトークンで、位置に使う。
+// トークンの間の空白は1つの空白になり、文字列リテラルの中の " と \ はエスケープする
+func (pp *preprocessor) stringize(hash *Token, toks []*Token) *Token {
+	var b strings.Builder
+	for i, t := range toks {
+		if i > 0 && t.space {
+			b.WriteByte(' ')
+		}
+		if t.kind == TKStr {
+			b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(t.str))
+			continue
+		}
+		b.WriteString(t.str)
+	}
+	str := `"` + b.String() + `"`
+	return &Token{kind: TKStr, str: str, len: len(str), pos: hash.pos, space: hash.space}
+}
+
+// "##" 演算子で、トークンlhsとrhsの綴りを連結した1つのトークンを返す
+func (pp *preprocessor) paste(lhs, rhs *Token) (*Token, error) {
+	tok, err := tokenize(lhs.str + rhs.str)
+	if err != nil || tok.kind == TKEOF || tok.next.kind != TKEOF {
+		return nil, pp.errorAt(lhs, "pasting %q and %q does not give a valid preprocessing token", lhs.str, rhs.str)
+	}
+	tok.pos = lhs.pos
+	tok.space = lhs.space
+	tok.next = nil
+	return tok, nil
+}
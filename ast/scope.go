@@ -0,0 +1,90 @@
+package ast
+
+// symbolKind は、通常の識別子の名前空間に登録された名前が何を表すかを示す
+type symbolKind int
+
+const (
+	symVar       symbolKind = iota // 変数
+	symTypedef                     // typedef名
+	symEnumConst                   // 列挙定数
+)
+
+// symbol は、通常の識別子の名前空間に登録された名前
+type symbol struct {
+	kind symbolKind
+	lvar *LVar // only used when kind = symVar and the variable is allocated on the stack
+	gvar *GVar // only used when kind = symVar and the variable has static storage duration
+	ty   *Type // only used when kind = symTypedef
+	val  int   // only used when kind = symEnumConst
+}
+
+// scope は、1つのブロックに対応する名前の有効範囲。
+// Cと同じく、変数、typedef名、列挙定数は通常の識別子として1つの名前空間を共有し、
+// 構造体、共用体、列挙型のタグはそれとは別の名前空間に属する
+type scope struct {
+	symbols map[string]*symbol
+	tags    map[string]*Type
+}
+
+func newScope() *scope {
+	return &scope{
+		symbols: make(map[string]*symbol),
+		tags:    make(map[string]*Type),
+	}
+}
+
+// ブロックに入るときに新しいスコープを作る
+func (p *TParser) enterScope() {
+	p.scopes = append(p.scopes, newScope())
+}
+
+// ブロックを抜けるときに最も内側のスコープを捨てる
+func (p *TParser) leaveScope() {
+	p.scopes = p.scopes[:len(p.scopes)-1]
+}
+
+// 現在のスコープがプログラムの最上位のスコープであるときtrueを返す。
+// 最上位はmain関数全体のスコープであり、ファイルスコープも兼ねる
+func (p *TParser) isFileScope() bool {
+	return len(p.scopes) == 1
+}
+
+// 最も内側のスコープを返す
+func (p *TParser) curScope() *scope {
+	return p.scopes[len(p.scopes)-1]
+}
+
+// 内側のスコープから順に、nameという名前の通常の識別子を検索する。存在しなければnilを返す
+func (p *TParser) findSymbol(name string) *symbol {
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if sym, ok := p.scopes[i].symbols[name]; ok {
+			return sym
+		}
+	}
+	return nil
+}
+
+// 内側のスコープから順に、nameという名前のタグを検索する。存在しなければnilを返す
+func (p *TParser) findTagType(name string) *Type {
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if ty, ok := p.scopes[i].tags[name]; ok {
+			return ty
+		}
+	}
+	return nil
+}
+
+// 現在のスコープに通常の識別子を登録する。同じスコープで既に宣言されている名前であればエラーを返す
+func (p *TParser) declareSymbol(name *Token, sym *symbol) error {
+	if _, ok := p.curScope().symbols[name.str]; ok {
+		return p.errorAt(name, "redefinition of %q", name.str)
+	}
+	p.curScope().symbols[name.str] = sym
+	return nil
+}
+
+// nameという名前のtypedef名が見えているときtrueを返す
+func (p *TParser) isTypedefName(name string) bool {
+	sym := p.findSymbol(name)
+	return sym != nil && sym.kind == symTypedef
+}
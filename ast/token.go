@@ -1,7 +1,9 @@
 package ast
 
 import (
+	"errors"
 	"strconv"
+	"strings"
 
 	"golang.org/x/xerrors"
 )
@@ -14,6 +16,7 @@ const (
 	TKEOF
 	TKIDENT
 	TKReturn // returnを表す専用トークン
+	TKStr    // 文字列リテラル
 )
 
 func (tk TokenKind) String() string {
@@ -24,6 +27,8 @@ func (tk TokenKind) String() string {
 		return "NUM"
 	case TKIDENT:
 		return "IDENTIFIER"
+	case TKStr:
+		return "STRING"
 	case TKEOF:
 		return "EOF"
 	default:
@@ -34,17 +39,24 @@ func (tk TokenKind) String() string {
 type Token struct {
 	kind TokenKind
 	next *Token
-	val  int    // TKNumの場合の値
-	str  string // トークン文字列
-	len  int    // トークン文字列の長さ。TKReservedの場合のみ >0
+	val  int     // TKNumの場合の値
+	fval float64 // 浮動小数点数リテラルの値
+	ty   *Type   // リテラルの型. 接尾辞のない10進整数リテラルの場合はnil
+	str  string  // トークン文字列
+	len  int     // トークン文字列の長さ。TKReservedの場合のみ >0
+	pos  int     // ソースコード先頭から数えたトークン開始位置(rune単位)
+
+	bol     bool    // 行の最初のトークンであるときtrue。前処理で設定する
+	space   bool    // 直前に空白があるときtrue。前処理で設定する
+	hideset hideset // このトークンから展開しないマクロの名前の集合。マクロの展開で設定する
 }
 
 // 新しいIDENT Tokenを作成してcurにつなげる
 func newIdentToken(cur *Token, str string) (*Token, error) {
 	// validation
 	for i, r := range str {
-		if !isLatin(r) {
-			return nil, xerrors.Errorf("%q is not a latin character which is illegal as variable name, %dth charachter of %q",
+		if !isAlnum(r) || i == 0 && isDigit(r) {
+			return nil, xerrors.Errorf("%q is illegal as variable name, %dth charachter of %q",
 				r, i+1, str)
 		}
 	}
@@ -58,17 +70,127 @@ func newIdentToken(cur *Token, str string) (*Token, error) {
 	return new, nil
 }
 
-// 新しい数値Tokenを作成してcurにつなげる
+// 新しい整数Tokenを作成してcurにつなげる。
+// 接尾辞のない10進数のリテラルは値から型が決まるのでtyを設定しない(typeOfを参照)。
+// それ以外のリテラルは、接頭辞と接尾辞で許される型のうち値を表せる最初の型をtyに設定する
 func newNumToken(cur *Token, str string) (*Token, error) {
 	new := &Token{
 		kind: TKNum,
 		str:  str,
 	}
-	val, err := strconv.Atoi(str)
+	digits, base := str, 10
+	switch {
+	case len(str) > 2 && strings.EqualFold(str[:2], "0x"):
+		digits, base = str[2:], 16
+	case len(str) > 2 && strings.EqualFold(str[:2], "0b"):
+		digits, base = str[2:], 2
+	case len(str) > 1 && str[0] == '0':
+		digits, base = str[1:], 8
+	}
+	end := len(digits)
+	for end > 0 && strings.ContainsRune("uUlL", rune(digits[end-1])) {
+		end--
+	}
+	suffix := digits[end:]
+	digits = digits[:end]
+	if base == 8 && digits == "" { // "0" や "0u" は8進数の0として扱う
+		digits = "0"
+	}
+	candidates, ok := integerLiteralTypes(suffix, base == 10)
+	if !ok {
+		return nil, xerrors.Errorf("invalid suffix %q on integer constant %q", suffix, str)
+	}
+	val, err := strconv.ParseUint(digits, base, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return nil, xerrors.Errorf("integer constant %q is too large for any integer type", str)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("invalid integer constant %q", str)
+	}
+	ty := fittingType(val, candidates)
+	if ty == nil {
+		return nil, xerrors.Errorf("integer constant %q is too large for any integer type", str)
+	}
+	if base != 10 || suffix != "" {
+		new.ty = ty
+	}
+	new.val = int(val)
+	cur.next = new
+	return new, nil
+}
+
+// integerLiteralTypes は、接尾辞suffixを持つ整数リテラルの型の候補を順に返す。
+// decimalは10進数のリテラルであるときtrueで、このとき接尾辞にuがなければ符号なしの型は候補にならない。
+// suffixが接尾辞として正しくなければfalseを返す
+func integerLiteralTypes(suffix string, decimal bool) ([]*Type, bool) {
+	var unsigned bool
+	var longs string
+	switch {
+	case strings.HasPrefix(suffix, "u") || strings.HasPrefix(suffix, "U"):
+		unsigned, longs = true, suffix[1:]
+	case strings.HasSuffix(suffix, "u") || strings.HasSuffix(suffix, "U"):
+		unsigned, longs = true, suffix[:len(suffix)-1]
+	default:
+		longs = suffix
+	}
+	var signed []*Type
+	switch longs {
+	case "":
+		signed = []*Type{IntType, LongType, LongLongType}
+	case "l", "L":
+		signed = []*Type{LongType, LongLongType}
+	case "ll", "LL":
+		signed = []*Type{LongLongType}
+	default:
+		return nil, false
+	}
+	var types []*Type
+	for _, ty := range signed {
+		if !unsigned {
+			types = append(types, ty)
+		}
+		if unsigned || !decimal {
+			types = append(types, unsignedOf(ty))
+		}
+	}
+	return types, true
+}
+
+// fittingType は、typesのうちvalを表せる最初の型を返す。どの型でも表せなければnilを返す
+func fittingType(val uint64, types []*Type) *Type {
+	for _, ty := range types {
+		bits := ty.Size * 8
+		if !ty.Unsigned {
+			bits--
+		}
+		if bits == 64 || val < 1<<uint(bits) {
+			return ty
+		}
+	}
+	return nil
+}
+
+// 新しい浮動小数点数Tokenを作成してcurにつなげる。
+// 接尾辞がfまたはFであればfloat型、それ以外はdouble型になる(long doubleはdoubleとして扱う)
+func newFloatToken(cur *Token, str string) (*Token, error) {
+	new := &Token{
+		kind: TKNum,
+		str:  str,
+		ty:   DoubleType,
+	}
+	digits := str
+	switch str[len(str)-1] {
+	case 'f', 'F':
+		new.ty = FloatType
+		digits = str[:len(str)-1]
+	case 'l', 'L':
+		digits = str[:len(str)-1]
+	}
+	val, err := strconv.ParseFloat(digits, 64)
 	if err != nil {
-		return nil, err
+		return nil, xerrors.Errorf("invalid floating constant %q. cause: %w", str, err)
 	}
-	new.val = val
+	new.fval = val
 	cur.next = new
 	return new, nil
 }
@@ -103,13 +225,68 @@ var reserved = map[int]map[string]bool{
 		">": true,
 		"=": true,
 		";": true,
+		":": true,
+		"{": true,
+		"}": true,
+		",": true,
+		".": true,
+		"&": true,
+		"[": true,
+		"]": true,
+		"#": true,
 	},
 	2: {
 		"==": true,
 		"!=": true,
 		"<=": true,
 		">=": true,
+		"->": true,
+		"##": true,
 	},
+	3: {
+		"...": true,
+	},
+}
+
+// 識別子と同じ形をしているが、TKReservedとして扱う予約語
+var keywords = map[string]bool{
+	"goto":     true,
+	"break":    true,
+	"continue": true,
+	"switch":   true,
+	"case":     true,
+	"default":  true,
+	"do":       true,
+	"while":    true,
+	"short":    true,
+	"int":      true,
+	"long":     true,
+	"signed":   true,
+	"unsigned": true,
+	"struct":   true,
+	"union":    true,
+	"enum":     true,
+	"typedef":  true,
+	"float":    true,
+	"double":   true,
+	"sizeof":   true,
+	"static":   true,
+	"extern":   true,
+	"const":    true,
+	"volatile": true,
+	"_Bool":    true,
+
+	"_Atomic":        true,
+	"_Alignof":       true,
+	"_Alignas":       true,
+	"_Static_assert": true,
+	"_Generic":       true,
+	"_Thread_local":  true,
+	"__thread":       true,
+	"asm":            true,
+	"__asm":          true,
+	"__asm__":        true,
+	"__volatile__":   true,
 }
 
 // one-char ops: +, -, *, /
@@ -118,17 +295,49 @@ func tokenize(src string) (*Token, error) {
 	head := new(Token)
 	cur := head
 	rs := []rune(src)
+	srcLen := len(rs)
 	for len(rs) > 0 {
+		pos := srcLen - len(rs) // これから読むトークンの開始位置
 		if isSpace(rs[0]) {
 			rs = rs[1:]
 			continue
 		}
+		if len(rs) > 1 && rs[0] == '\\' && rs[1] == '\n' { // 行の継続
+			rs = rs[2:]
+			continue
+		}
 		if isReturn(rs) {
 			cur = newToken(TKReturn, cur, returnWord)
+			cur.pos = pos
 			rs = rs[len(returnWord):]
 			continue
 		}
+		if i := readFloat(rs); i > 0 {
+			c, err := newFloatToken(cur, string(rs[:i]))
+			if err != nil {
+				return nil, err
+			}
+			cur = c
+			cur.pos = pos
+			rs = rs[i:]
+			continue
+		}
+
+		if rs[0] == '"' {
+			i := readString(rs)
+			if i < 0 {
+				return nil, xerrors.Errorf("%s: unterminated string literal", position([]rune(src), pos))
+			}
+			cur = newToken(TKStr, cur, string(rs[:i]))
+			cur.pos = pos
+			rs = rs[i:]
+			continue
+		}
+
 		reservedWord := func() string {
+			if len(rs) > 2 && reserved[3][string(rs[:3])] {
+				return string(rs[:3])
+			}
 			if len(rs) > 1 && reserved[2][string(rs[:2])] {
 				return string(rs[:2])
 			}
@@ -139,37 +348,47 @@ func tokenize(src string) (*Token, error) {
 		}()
 		if len(reservedWord) > 0 { // 何らかの予約語トークンにマッチした場合
 			cur = newToken(TKReserved, cur, reservedWord)
+			cur.pos = pos
 			rs = rs[len(reservedWord):]
 			continue
 		}
 
-		if i := readLatin(rs); i > 0 {
+		if i := readIdent(rs); i > 0 {
+			if word := string(rs[:i]); keywords[word] {
+				cur = newToken(TKReserved, cur, word)
+				cur.pos = pos
+				rs = rs[i:]
+				continue
+			}
 			c, err := newIdentToken(cur, string(rs[:i]))
 			if err != nil {
 				return nil, xerrors.Errorf("failed to read IDENT Token. cause: %w", err)
 			}
 			cur = c
+			cur.pos = pos
 			rs = rs[i:]
 			continue
 		}
 
-		if i := readDigit(rs); i > 0 {
+		if i := readNumber(rs); i > 0 {
 			c, err := newNumToken(cur, string(rs[:i]))
 			if err != nil {
-				return nil, err
+				return nil, xerrors.Errorf("%s: %w", position([]rune(src), pos), err)
 			}
 			cur = c
+			cur.pos = pos
 			rs = rs[i:]
 			continue
 		}
 		break // 予想しない文字が来た場合はその場でtokenizeを終了する
 	}
 	cur = newToken(TKEOF, cur, "")
+	cur.pos = srcLen - len(rs)
 	return head.next, nil
 }
 
 func isSpace(r rune) bool {
-	return r == ' '
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\v' || r == '\f'
 }
 
 // 何桁目まで数値であるかを返す
@@ -181,10 +400,101 @@ func readDigit(rs []rune) int {
 	return i
 }
 
-// 何桁目までがラテン文字 'a'-'z'及び'A'-'Z'であるかを返す
-func readLatin(rs []rune) int {
-	var i int
-	for i < len(rs) && isLatin(rs[i]) {
+// rsの先頭の文字列リテラルの、前後の " を含めた長さを返す。文字列リテラルが閉じていなければ-1を返す。
+// バックスラッシュの直後の文字はエスケープされているものとして読み飛ばす
+func readString(rs []rune) int {
+	for i := 1; i < len(rs); i++ {
+		switch rs[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// 文字列リテラルのエスケープシーケンスで、バックスラッシュに続く文字と表す文字
+var escapeSequences = map[rune]rune{
+	'n': '\n', 't': '\t', 'r': '\r', 'a': '\a', 'b': '\b', 'f': '\f', 'v': '\v',
+	'0': 0, '\\': '\\', '"': '"', '\'': '\'', '?': '?',
+}
+
+// 前後の " を含めた文字列リテラルlitから、エスケープシーケンスを解釈した内容を返す
+func unquote(lit string) (string, error) {
+	rs := []rune(lit[1 : len(lit)-1])
+	var b strings.Builder
+	for i := 0; i < len(rs); i++ {
+		if rs[i] != '\\' {
+			b.WriteRune(rs[i])
+			continue
+		}
+		i++
+		c, ok := escapeSequences[rs[i]]
+		if !ok {
+			return "", xerrors.Errorf("unknown escape sequence '\\%c'", rs[i])
+		}
+		b.WriteRune(c)
+	}
+	return b.String(), nil
+}
+
+// rsの先頭が数字であれば、そこから続く英数字の並びを整数リテラルとみなしてその長さを返す。
+// 接頭辞や接尾辞の正しさはnewNumTokenで検査する
+func readNumber(rs []rune) int {
+	i := readDigit(rs)
+	if i == 0 {
+		return 0
+	}
+	for i < len(rs) && isAlnum(rs[i]) {
+		i++
+	}
+	return i
+}
+
+// rsの先頭が浮動小数点数リテラルであれば、その長さを返す。それ以外の場合は0を返す。
+// 浮動小数点数リテラルは、小数点または指数部を含み、fFlLのいずれかの接尾辞を付けられる
+func readFloat(rs []rune) int {
+	i := readDigit(rs)
+	mantissa := i // 仮数部の数字の個数
+	isFloat := false
+	if i < len(rs) && rs[i] == '.' {
+		isFloat = true
+		i++
+		n := readDigit(rs[i:])
+		mantissa += n
+		i += n
+	}
+	if mantissa == 0 {
+		return 0
+	}
+	if i < len(rs) && (rs[i] == 'e' || rs[i] == 'E') {
+		j := i + 1
+		if j < len(rs) && (rs[j] == '+' || rs[j] == '-') {
+			j++
+		}
+		if n := readDigit(rs[j:]); n > 0 {
+			isFloat = true
+			i = j + n
+		}
+	}
+	if !isFloat {
+		return 0
+	}
+	if i < len(rs) && strings.ContainsRune("fFlL", rs[i]) {
+		i++
+	}
+	return i
+}
+
+// rsの先頭が識別子であれば、その長さを返す。
+// 識別子はラテン文字または_で始まり、ラテン文字、数字、_が続く
+func readIdent(rs []rune) int {
+	if len(rs) == 0 || !isLatin(rs[0]) && rs[0] != '_' {
+		return 0
+	}
+	i := 1
+	for i < len(rs) && isAlnum(rs[i]) {
 		i++
 	}
 	return i
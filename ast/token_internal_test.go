@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -46,17 +47,20 @@ func TestTokenizeToLinkedList(t *testing.T) {
 			source: " 1 + 1 ",
 			expect: &Token{
 				kind: TKNum,
+				pos:  1,
 				str:  "1",
 				val:  1,
 				next: &Token{
 					kind: TKReserved,
+					pos:  3,
 					str:  "+",
 					len:  1,
 					next: &Token{
 						kind: TKNum,
+						pos:  5,
 						str:  "1",
 						val:  1,
-						next: &Token{kind: TKEOF},
+						next: &Token{kind: TKEOF, pos: 7},
 					},
 				},
 			},
@@ -70,13 +74,15 @@ func TestTokenizeToLinkedList(t *testing.T) {
 				val:  1,
 				next: &Token{
 					kind: TKReserved,
+					pos:  1,
 					str:  "+",
 					len:  1,
 					next: &Token{
 						kind: TKNum,
+						pos:  2,
 						str:  "1",
 						val:  1,
-						next: &Token{kind: TKEOF},
+						next: &Token{kind: TKEOF, pos: 3},
 					},
 				},
 			},
@@ -90,13 +96,15 @@ func TestTokenizeToLinkedList(t *testing.T) {
 				val:  1,
 				next: &Token{
 					kind: TKReserved,
+					pos:  1,
 					str:  "==",
 					len:  2,
 					next: &Token{
 						kind: TKNum,
+						pos:  3,
 						str:  "1",
 						val:  1,
-						next: &Token{kind: TKEOF},
+						next: &Token{kind: TKEOF, pos: 4},
 					},
 				},
 			},
@@ -110,13 +118,15 @@ func TestTokenizeToLinkedList(t *testing.T) {
 				len:  1,
 				next: &Token{
 					kind: TKReserved,
+					pos:  1,
 					str:  "=",
 					len:  1,
 					next: &Token{
 						kind: TKNum,
+						pos:  2,
 						str:  "1",
 						val:  1,
-						next: &Token{kind: TKEOF},
+						next: &Token{kind: TKEOF, pos: 3},
 					},
 				},
 			},
@@ -130,13 +140,15 @@ func TestTokenizeToLinkedList(t *testing.T) {
 				len:  1,
 				next: &Token{
 					kind: TKReserved,
+					pos:  1,
 					str:  "=",
 					len:  1,
 					next: &Token{
 						kind: TKIDENT,
+						pos:  2,
 						str:  "z",
 						len:  1,
-						next: &Token{kind: TKEOF},
+						next: &Token{kind: TKEOF, pos: 3},
 					},
 				},
 			},
@@ -150,13 +162,15 @@ func TestTokenizeToLinkedList(t *testing.T) {
 				str:  "1",
 				next: &Token{
 					kind: TKReserved,
+					pos:  1,
 					str:  ";",
 					len:  1,
 					next: &Token{
 						kind: TKNum,
+						pos:  2,
 						val:  1,
 						str:  "1",
-						next: &Token{kind: TKEOF},
+						next: &Token{kind: TKEOF, pos: 3},
 					},
 				},
 			},
@@ -168,7 +182,7 @@ func TestTokenizeToLinkedList(t *testing.T) {
 				kind: TKIDENT,
 				str:  "ab",
 				len:  2,
-				next: &Token{kind: TKEOF},
+				next: &Token{kind: TKEOF, pos: 2},
 			},
 		},
 		{
@@ -180,9 +194,10 @@ func TestTokenizeToLinkedList(t *testing.T) {
 				len:  6,
 				next: &Token{
 					kind: TKReserved,
+					pos:  6,
 					str:  ";",
 					len:  1,
-					next: &Token{kind: TKEOF},
+					next: &Token{kind: TKEOF, pos: 7},
 				},
 			},
 		},
@@ -195,13 +210,15 @@ func TestTokenizeToLinkedList(t *testing.T) {
 				len:  6,
 				next: &Token{
 					kind: TKNum,
+					pos:  7,
 					str:  "1",
 					val:  1,
 					next: &Token{
 						kind: TKReserved,
+						pos:  8,
 						str:  ";",
 						len:  1,
-						next: &Token{kind: TKEOF},
+						next: &Token{kind: TKEOF, pos: 9},
 					},
 				},
 			},
@@ -215,9 +232,10 @@ func TestTokenizeToLinkedList(t *testing.T) {
 				len:  8,
 				next: &Token{
 					kind: TKReserved,
+					pos:  8,
 					str:  ";",
 					len:  1,
-					next: &Token{kind: TKEOF},
+					next: &Token{kind: TKEOF, pos: 9},
 				},
 			},
 		},
@@ -234,3 +252,223 @@ func TestTokenizeToLinkedList(t *testing.T) {
 		})
 	}
 }
+
+func TestTokenizeFloat(t *testing.T) {
+	testcases := [...]struct {
+		source string
+		fval   float64
+		ty     *Type
+	}{
+		{source: "1.5", fval: 1.5, ty: DoubleType},
+		{source: ".25", fval: 0.25, ty: DoubleType},
+		{source: "3.", fval: 3, ty: DoubleType},
+		{source: "1e3", fval: 1000, ty: DoubleType},
+		{source: "2.5E-1", fval: 0.25, ty: DoubleType},
+		{source: "1e+2", fval: 100, ty: DoubleType},
+		{source: "0.5f", fval: 0.5, ty: FloatType},
+		{source: "1.5L", fval: 1.5, ty: DoubleType},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.source, func(t *testing.T) {
+			got, err := tokenize(tt.source)
+			if err != nil {
+				t.Fatalf("[%q] expect error to be nil but got:\n %+v", tt.source, err)
+			}
+			if got.kind != TKNum || got.fval != tt.fval || got.ty != tt.ty {
+				t.Errorf("[%q] expect float token of value %v and type %v but got %+v", tt.source, tt.fval, tt.ty, *got)
+			}
+		})
+	}
+}
+
+func TestTokenizeInteger(t *testing.T) {
+	testcases := [...]struct {
+		source string
+		val    int
+		ty     *Type
+	}{
+		{source: "42", val: 42, ty: nil}, // 接尾辞のない10進数は値から型が決まる
+		{source: "0x1F", val: 31, ty: IntType},
+		{source: "0XfF", val: 255, ty: IntType},
+		{source: "017", val: 15, ty: IntType},
+		{source: "0", val: 0, ty: nil},
+		{source: "0b101", val: 5, ty: IntType},
+		{source: "10u", val: 10, ty: UIntType},
+		{source: "10l", val: 10, ty: LongType},
+		{source: "10LL", val: 10, ty: LongLongType},
+		{source: "10ul", val: 10, ty: ULongType},
+		{source: "10LLU", val: 10, ty: ULongLongType},
+		{source: "0xFFFFFFFF", val: 0xFFFFFFFF, ty: UIntType},
+		{source: "4294967295u", val: 4294967295, ty: UIntType},
+		{source: "4294967296u", val: 4294967296, ty: ULongType},
+		{source: "0x100000000", val: 0x100000000, ty: LongType},
+		{source: "2147483648l", val: 2147483648, ty: LongType},
+		{source: "0xFFFFFFFFFFFFFFFF", val: -1, ty: ULongType},
+		{source: "0x8000000000000000ll", val: -1 << 63, ty: ULongLongType},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.source, func(t *testing.T) {
+			got, err := tokenize(tt.source)
+			if err != nil {
+				t.Fatalf("[%q] expect error to be nil but got:\n %+v", tt.source, err)
+			}
+			if got.kind != TKNum || got.val != tt.val || got.ty != tt.ty || got.next.kind != TKEOF {
+				t.Errorf("[%q] expect integer token of value %v and type %v but got %+v", tt.source, tt.val, tt.ty, *got)
+			}
+		})
+	}
+}
+
+func TestTokenize_Invalid(t *testing.T) {
+	testcases := [...]struct {
+		source string
+		expect string
+	}{
+		{source: "1+4F", expect: `1:3: invalid integer constant "4F"`},
+		{source: "1lL", expect: `1:1: invalid suffix "lL" on integer constant "1lL"`},
+		{source: "1uu", expect: `1:1: invalid suffix "uu" on integer constant "1uu"`},
+		{source: "08", expect: `1:1: invalid integer constant "08"`},
+		{source: "0b102", expect: `1:1: invalid integer constant "0b102"`},
+		{source: "0x", expect: `1:1: invalid integer constant "0x"`},
+		{source: "9223372036854775808", expect: `1:1: integer constant "9223372036854775808" is too large for any integer type`},
+		{source: "18446744073709551616u", expect: `1:1: integer constant "18446744073709551616u" is too large for any integer type`},
+		{source: `_Static_assert(1, "abc\");`, expect: "1:19: unterminated string literal"},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.source, func(t *testing.T) {
+			_, err := tokenize(tt.source)
+			if err == nil {
+				t.Fatalf("[%q] expect error to be not nil but got nil", tt.source)
+			}
+			if !strings.Contains(err.Error(), tt.expect) {
+				t.Errorf("[%q] expect error to contain %q but got %q", tt.source, tt.expect, err.Error())
+			}
+		})
+	}
+}
+
+func TestReadFloat(t *testing.T) {
+	testcases := [...]struct {
+		source string
+		expect int
+	}{
+		{source: "1.5+1", expect: 3},
+		{source: "10", expect: 0},
+		{source: "1e", expect: 0},
+		{source: "1e+", expect: 0},
+		{source: "1.e5;", expect: 4},
+		{source: ".x", expect: 0},
+		{source: ".5f)", expect: 3},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.source, func(t *testing.T) {
+			if got := readFloat([]rune(tt.source)); got != tt.expect {
+				t.Errorf("[%q] expect %d but got %d", tt.source, tt.expect, got)
+			}
+		})
+	}
+}
+
+func TestPreprocess(t *testing.T) {
+	testcases := [...]struct {
+		title  string
+		source string
+		expect string // 展開したトークンの綴りを空白で区切って並べたもの
+	}{
+		{title: "object-like", source: "#define N 3\nN + N;", expect: "3 + 3 ;"},
+		{title: "empty body", source: "#define E\nE 1 E;", expect: "1 ;"},
+		{title: "null directive", source: "#\n1;", expect: "1 ;"},
+		{title: "# not at beginning of line", source: "a # b;", expect: "a # b ;"},
+		{title: "undef", source: "#define N 3\nN;\n#undef N\nN;", expect: "3 ; N ;"},
+		{title: "redefine", source: "#define N 3\n#define N 4\nN;", expect: "4 ;"},
+		{title: "line continuation", source: "#define N 1 + \\\n 2\nN;", expect: "1 + 2 ;"},
+		{title: "function-like", source: "#define F(a, b) (b - a)\nF(1, 2);", expect: "( 2 - 1 ) ;"},
+		{title: "nested parentheses in argument", source: "#define F(a) [a]\nF((1, 2));", expect: "[ ( 1 , 2 ) ] ;"},
+		{title: "function-like without parentheses", source: "#define F(a) a\nF;", expect: "F ;"},
+		{title: "space before parameter list", source: "#define F (a) a\nF(1);", expect: "( a ) a ( 1 ) ;"},
+		{title: "no parameters", source: "#define F() 1\nF();", expect: "1 ;"},
+		{title: "keyword as macro name", source: "#define long int\nlong x;", expect: "int x ;"},
+		{title: "argument is expanded", source: "#define N 2\n#define F(a) a * a\nF(N);", expect: "2 * 2 ;"},
+		{title: "rescan", source: "#define F(a) G(a)\n#define G(a) a + 1\nF(0);", expect: "0 + 1 ;"},
+		{title: "self reference", source: "#define x x + 1\nx;", expect: "x + 1 ;"},
+		{title: "mutual reference", source: "#define x y\n#define y x\nx; y;", expect: "x ; y ;"},
+		{title: "self reference in function-like", source: "#define f(a) f(a + 1)\nf(f(0));", expect: "f ( f ( 0 + 1 ) + 1 ) ;"},
+		{title: "name of function-like from expansion", source: "#define f(a) a * g\n#define g f\nf(2)(9);", expect: "2 * f ( 9 ) ;"},
+		{title: "stringize", source: "#define S(a) #a\nS(  1  +\n 2 );", expect: `"1 + 2" ;`},
+		{title: "stringize string literal", source: "#define S(a) #a\nS(\"a\\n\");", expect: `"\"a\\n\"" ;`},
+		{title: "stringize empty argument", source: "#define S(a) #a\nS();", expect: `"" ;`},
+		{title: "paste", source: "#define C(a, b) a ## b\nC(x, 1) C(<, =) C(1, 2.5);", expect: "x1 <= 12.5 ;"},
+		{title: "paste in object-like", source: "#define N 1 ## 0\nN;", expect: "10 ;"},
+		{title: "paste is not expanded", source: "#define N 1\n#define C(a) a ## 2 a\nC(N);", expect: "N2 1 ;"},
+		{title: "paste result is rescanned", source: "#define xy 7\n#define C(a, b) a ## b\nC(x, y);", expect: "7 ;"},
+		{title: "paste empty arguments", source: "#define C(a, b, c) [a ## b ## c]\nC(,,) C(,1,) C(1,,);", expect: "[ ] [ 1 ] [ 1 ] ;"},
+		{title: "paste empty right operand", source: "#define C(a) x ## a\nC();", expect: "x ;"},
+		{title: "variadic", source: "#define F(a, ...) a: __VA_ARGS__\nF(1, 2, (3, 4));", expect: "1 : 2 , ( 3 , 4 ) ;"},
+		{title: "variadic without arguments", source: "#define F(...) [__VA_ARGS__]\nF();", expect: "[ ] ;"},
+		{title: "omitted variadic argument", source: "#define F(a, ...) a __VA_ARGS__\nF(1);", expect: "1 ;"},
+		{title: "stringize variadic", source: "#define S(...) #__VA_ARGS__\nS(a,b , c);", expect: `"a,b , c" ;`},
+		{title: "builtin macros", source: "bool b = true + false;", expect: "_Bool b = 1 + 0 ;"},
+		{title: "undef builtin macro", source: "#undef true\ntrue;", expect: "true ;"},
+		{title: "comma elision", source: "#define F(a, ...) f(a, ## __VA_ARGS__)\nF(1) F(1, 2);", expect: "f ( 1 ) f ( 1 , 2 ) ;"},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.title, func(t *testing.T) {
+			tok, err := tokenize(tt.source)
+			if err != nil {
+				t.Fatalf("[%q] expect error to be nil but got:\n %+v", tt.source, err)
+			}
+			tok, err = preprocess(tt.source, tok)
+			if err != nil {
+				t.Fatalf("[%q] expect error to be nil but got:\n %+v", tt.source, err)
+			}
+			var got []string
+			for ; tok.kind != TKEOF; tok = tok.next {
+				got = append(got, tok.str)
+			}
+			if diff := cmp.Diff(strings.Join(got, " "), tt.expect); diff != "" {
+				t.Errorf("[%q] differs: (-got +expect)\n%s", tt.source, diff)
+			}
+		})
+	}
+}
+
+func TestPreprocess_Invalid(t *testing.T) {
+	testcases := [...]struct {
+		source string
+		expect string
+	}{
+		{source: "#define\n1;", expect: "1:2: macro name missing"},
+		{source: "#define 1 2\n1;", expect: "1:2: macro name missing"},
+		{source: "#undef\n", expect: "1:2: macro name missing"},
+		{source: "#undef N 1\n", expect: "1:10: extra tokens at end of #undef directive"},
+		{source: "#include <stdio.h>\n", expect: "1:2: invalid preprocessing directive #include"},
+		{source: "#define F(a, a) a\n", expect: `1:14: duplicate macro parameter "a"`},
+		{source: "#define F(a, 1) a\n", expect: `1:14: expected parameter name, found "1"`},
+		{source: "#define F(a b) a\n", expect: "1:10: missing ')' in macro parameter list"},
+		{source: "#define F(a, ... b) a\n", expect: "1:14: missing ')' in macro parameter list"},
+		{source: "#define F(a) #b\n", expect: "1:14: '#' is not followed by a macro parameter"},
+		{source: "#define N ## 1\n", expect: "1:11: '##' cannot appear at either end of a macro expansion"},
+		{source: "#define F(a) a ##\n", expect: "1:16: '##' cannot appear at either end of a macro expansion"},
+		{source: "#define F(a) __VA_ARGS__\n", expect: "1:14: __VA_ARGS__ can only appear in the expansion of a variadic macro"},
+		{source: "#define F(a) a\nF(1;", expect: `2:1: unterminated argument list invoking macro "F"`},
+		{source: "#define F(a, b) a\nF(1);", expect: `2:1: macro "F" requires 2 arguments, but only 1 given`},
+		{source: "#define F(a) a\nF(1, 2);", expect: `2:1: macro "F" passed 2 arguments, but takes just 1`},
+		{source: "#define F() 1\nF(2);", expect: `2:1: macro "F" passed 1 arguments, but takes just 0`},
+		{source: "#define C(a, b) a ## b\nC(+, /);", expect: `2:3: pasting "+" and "/" does not give a valid preprocessing token`},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.source, func(t *testing.T) {
+			tok, err := tokenize(tt.source)
+			if err != nil {
+				t.Fatalf("[%q] expect error to be nil but got:\n %+v", tt.source, err)
+			}
+			_, err = preprocess(tt.source, tok)
+			if err == nil {
+				t.Fatalf("[%q] expect error to be not nil but got nil", tt.source)
+			}
+			if !strings.Contains(err.Error(), tt.expect) {
+				t.Errorf("[%q] expect error to contain %q but got %q", tt.source, tt.expect, err.Error())
+			}
+		})
+	}
+}
@@ -10,6 +10,26 @@ type TParser struct {
 	token *Token
 	pos   int
 	lvar  *LVar
+	src   []rune // エラー位置の表示に使う
+
+	// ラベルとgotoの解決に使う。全体で1つの関数しか存在しないので、プログラム全体で1つの名前空間になる
+	labels map[string]bool // 定義済みのラベル名
+	gotos  []*Token        // goto文で参照されたラベル名のトークン
+
+	// 値を持たない文式と、その "(" のトークン。式文全体であるものは値を捨てるので取り除き、残ったものはエラーにする
+	voidStmtExprs []voidStmtExpr
+
+	brkLabels  []string // breakのジャンプ先ラベルのスタック。末尾が最も内側のループまたはswitchに対応する
+	contLabels []string // continueのジャンプ先ラベルのスタック。末尾が最も内側のループに対応する
+	curSwitch  *Node    // 現在parse中の最も内側のswitch文。switch文の外ではnil
+	labelCount int      // ユニークなラベル名を作るためのカウンタ
+
+	scopes []*scope // 名前の有効範囲のスタック。末尾が最も内側のブロックに対応する
+
+	globals []*GVar // 静的記憶域期間を持つ変数
+
+	// 不完全な構造体型・共用体型から作った修飾された型。元の型が完成したときに大きさとメンバーを反映する
+	incompleteQualified map[*Type][]*Type
 }
 
 func NewTParser(src string) (*TParser, error) {
@@ -17,9 +37,18 @@ func NewTParser(src string) (*TParser, error) {
 	if err != nil {
 		return nil, err
 	}
+	t, err = preprocess(src, t)
+	if err != nil {
+		return nil, err
+	}
 	return &TParser{
-		token: t,
-		lvar:  &LVar{}, // offset = 0 で name == ""のダミーローカル変数を設定しておく
+		token:  t,
+		lvar:   &LVar{}, // offset = 0 で name == ""のダミーローカル変数を設定しておく
+		src:    []rune(src),
+		labels: make(map[string]bool),
+		scopes: []*scope{newScope()}, // 関数全体のスコープ。ファイルスコープも兼ねる
+
+		incompleteQualified: make(map[*Type][]*Type),
 	}, nil
 }
 
@@ -56,9 +85,25 @@ func (p *TParser) Program() ([]*Node, error) {
 		}
 		result = append(result, node)
 	}
+	if err := p.resolveGotos(); err != nil {
+		return result, xerrors.Errorf("failed to parse program. cause: %w", err)
+	}
+	if len(p.voidStmtExprs) > 0 {
+		return result, p.errorAt(p.voidStmtExprs[0].tok, "value of statement expression is used but it does not end with an expression statement")
+	}
 	return result, nil
 }
 
+// goto文で参照されたラベルが全て定義されていることを確かめる
+func (p *TParser) resolveGotos() error {
+	for _, tok := range p.gotos {
+		if !p.labels[tok.str] {
+			return p.errorAt(tok, "label %q used but not defined", tok.str)
+		}
+	}
+	return nil
+}
+
 func (p *TParser) stmt() (*Node, error) {
 	if p.consumeReturn() {
 		node, err := p.expr()
@@ -70,6 +115,135 @@ func (p *TParser) stmt() (*Node, error) {
 		}
 		return NewNode(Return, node, nil), nil
 	}
+	if p.consume("goto") {
+		tok := p.token
+		if tok.kind != TKIDENT {
+			return nil, p.errorAt(tok, "expect label name after goto but got %q", tok.str)
+		}
+		p.token = p.token.next
+		p.pos++
+		if err := p.expect(";"); err != nil {
+			return nil, xerrors.Errorf("failed to parse goto statement. cause:\n%w", err)
+		}
+		p.gotos = append(p.gotos, tok)
+		return &Node{Kind: Goto, Name: tok.str, Label: labelName(tok.str)}, nil
+	}
+	if tok := p.token; p.consume("break") {
+		if len(p.brkLabels) == 0 {
+			return nil, p.errorAt(tok, "break statement not within loop or switch")
+		}
+		if err := p.expect(";"); err != nil {
+			return nil, xerrors.Errorf("failed to parse break statement. cause:\n%w", err)
+		}
+		return &Node{Kind: Break, Label: p.brkLabels[len(p.brkLabels)-1]}, nil
+	}
+	if tok := p.token; p.consume("continue") {
+		if len(p.contLabels) == 0 {
+			return nil, p.errorAt(tok, "continue statement not within a loop")
+		}
+		if err := p.expect(";"); err != nil {
+			return nil, xerrors.Errorf("failed to parse continue statement. cause:\n%w", err)
+		}
+		return &Node{Kind: Continue, Label: p.contLabels[len(p.contLabels)-1]}, nil
+	}
+	// ラベルは通常の識別子とは別の名前空間に属するので、typedef名と同じ名前でもラベルとして扱う
+	if p.isLabel() {
+		tok := p.token
+		if p.labels[tok.str] {
+			return nil, p.errorAt(tok, "duplicate label %q", tok.str)
+		}
+		p.labels[tok.str] = true
+		p.token = p.token.next
+		p.pos++
+		if err := p.expect(":"); err != nil {
+			return nil, xerrors.Errorf("failed to parse labeled statement. cause:\n%w", err)
+		}
+		node, err := p.stmt()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse labeled statement. cause:\n%w", err)
+		}
+		return &Node{Kind: Label, Name: tok.str, Label: labelName(tok.str), Lhs: node}, nil
+	}
+	if p.isTypeName(p.token) {
+		return p.declaration()
+	}
+	if tok := p.token; p.consume("_Static_assert") {
+		if err := p.staticAssert(tok); err != nil {
+			return nil, err
+		}
+		return &Node{Kind: Block}, nil
+	}
+	if tok := p.token; p.consume("asm") || p.consume("__asm") || p.consume("__asm__") {
+		return p.asmStmt(tok)
+	}
+	if p.consume("{") {
+		p.enterScope()
+		node, err := p.compoundStmt()
+		p.leaveScope()
+		return node, err
+	}
+	if tok := p.token; p.consume("switch") {
+		return p.switchStmt(tok)
+	}
+	if p.consume("do") {
+		return p.doWhileStmt()
+	}
+	if tok := p.token; p.consume("while") {
+		// whileはdo-while文の一部としてのみ使える
+		return nil, p.errorAt(tok, "while loop is not supported; use do-while instead")
+	}
+	if tok := p.token; p.consume("case") {
+		if p.curSwitch == nil {
+			return nil, p.errorAt(tok, "case label not within a switch statement")
+		}
+		valNode, err := p.equality()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse case label. cause:\n%w", err)
+		}
+		val, err := eval(valNode)
+		if err != nil {
+			return nil, p.errorAt(tok, "case label is not an integer constant: %v", err)
+		}
+		// case値は制御式を整数拡張した型に変換してから比較する
+		val = truncateInt(val, integerPromotion(typeOf(p.curSwitch.Lhs)))
+		for _, c := range p.curSwitch.Cases {
+			if c.Kind == Case && c.Value == val {
+				return nil, p.errorAt(tok, "duplicate case value %d", val)
+			}
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, xerrors.Errorf("failed to parse case label. cause:\n%w", err)
+		}
+		node := &Node{Kind: Case, Value: val, Label: p.newLabel("case")}
+		p.curSwitch.Cases = append(p.curSwitch.Cases, node)
+		stmt, err := p.stmt()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse case label. cause:\n%w", err)
+		}
+		node.Lhs = stmt
+		return node, nil
+	}
+	if tok := p.token; p.consume("default") {
+		if p.curSwitch == nil {
+			return nil, p.errorAt(tok, "default label not within a switch statement")
+		}
+		for _, c := range p.curSwitch.Cases {
+			if c.Kind == Default {
+				return nil, p.errorAt(tok, "multiple default labels in one switch")
+			}
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, xerrors.Errorf("failed to parse default label. cause:\n%w", err)
+		}
+		node := &Node{Kind: Default, Label: p.newLabel("default")}
+		p.curSwitch.Cases = append(p.curSwitch.Cases, node)
+		stmt, err := p.stmt()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse default label. cause:\n%w", err)
+		}
+		node.Lhs = stmt
+		return node, nil
+	}
 	node, err := p.expr()
 	if err != nil {
 		return nil, xerrors.Errorf("failed to parse statement. cause:\n%w", err)
@@ -77,6 +251,7 @@ func (p *TParser) stmt() (*Node, error) {
 	if err := p.expect(";"); err != nil {
 		return nil, xerrors.Errorf("failed to parse statement. cause:\n%w", err)
 	}
+	p.discardVoidStmtExpr(node)
 	return node, nil
 }
 
@@ -93,16 +268,64 @@ func (p *TParser) assign() (*Node, error) {
 	if err != nil {
 		return nil, xerrors.Errorf("failed to parse left hand side of =. caused by %w", err)
 	}
-	if p.token.kind != TKEOF && p.consume("=") {
+	if tok := p.token; p.token.kind != TKEOF && p.consume("=") {
 		rhs, err := p.assign()
 		if err != nil {
 			return nil, xerrors.Errorf("failed to parse right hand side of =. caused by %w", err)
 		}
+		lty := typeOf(node)
+		if lty.Kind == TyArray || lty.Kind == TyFunc {
+			return nil, p.errorAt(tok, "%s type is not assignable", lty.Kind)
+		}
+		if lty.Const {
+			return nil, p.errorAt(tok, "cannot assign to lvalue with const-qualified type %s", qualifiedName(lty))
+		}
+		if hasConstMember(lty) {
+			return nil, p.errorAt(tok, "cannot assign to %s with const-qualified member", lty.Kind)
+		}
+		if err := p.checkAssignable(tok, typeOf(node), typeOf(rhs)); err != nil {
+			return nil, err
+		}
 		node = NewNode(Assign, node, rhs)
 	}
 	return node, nil
 }
 
+// 型rtyの値を型ltyのオブジェクトに代入できることを確かめる。tokはエラー表示に使う
+// ポインタの指す先の型から修飾子を取り除く暗黙の変換もエラーにする
+func (p *TParser) checkAssignable(tok *Token, lty, rty *Type) error {
+	if (lty.IsAggregate() || rty.IsAggregate()) && lty.Unqualified() != rty.Unqualified() || isPointerFlonumPair(lty, rty) {
+		return p.errorAt(tok, "incompatible types in assignment to %s from %s", lty.Kind, rty.Kind)
+	}
+	if lty.Kind == TyPtr && rty.hasBase() && discardsQualifiers(lty.Base, rty.Base) {
+		return p.errorAt(tok, "assignment to pointer to %s from pointer to %s discards qualifiers",
+			qualifiedName(lty.Base), qualifiedName(rty.Base))
+	}
+	return nil
+}
+
+// 型fromの修飾子のうち型toに付いていないものがあるときtrueを返す
+func discardsQualifiers(to, from *Type) bool {
+	return from.Const && !to.Const || from.Volatile && !to.Volatile || from.Atomic && !to.Atomic
+}
+
+// 構造体型または共用体型tyが、const修飾されたメンバーを(入れ子の構造体の中も含めて)持つときtrueを返す
+func hasConstMember(ty *Type) bool {
+	if !ty.IsAggregate() {
+		return false
+	}
+	for _, m := range ty.Unqualified().Members {
+		mty := m.Type
+		for mty.Kind == TyArray {
+			mty = mty.Base
+		}
+		if mty.Const || hasConstMember(mty) {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *TParser) debug() {
 	fmt.Printf("DEBUG: current pos = %v, kind = %q, label = %q\n", p.pos, p.token.kind, p.token.str)
 }
@@ -178,20 +401,24 @@ func (p *TParser) add() (*Node, error) {
 		return nil, err
 	}
 	for p.token.kind != TKEOF {
-		if p.consume("+") {
+		if tok := p.token; p.consume("+") {
 			rhs, err := p.mul()
 			if err != nil {
 				return nil, err
 			}
-			node = NewNode(Add, node, rhs)
+			if node, err = p.newAdd(node, rhs, tok); err != nil {
+				return nil, err
+			}
 			continue
 		}
-		if p.consume("-") {
+		if tok := p.token; p.consume("-") {
 			rhs, err := p.mul()
 			if err != nil {
 				return nil, err
 			}
-			node = NewNode(Sub, node, rhs)
+			if node, err = p.newSub(node, rhs, tok); err != nil {
+				return nil, err
+			}
 			continue
 		}
 		break
@@ -199,20 +426,63 @@ func (p *TParser) add() (*Node, error) {
 	return node, nil
 }
 
+// lhs + rhs を表すNodeを返す。ポインタと整数の加算では、整数に指す先の型のサイズを掛ける。tokはエラー表示に使う
+func (p *TParser) newAdd(lhs, rhs *Node, tok *Token) (*Node, error) {
+	lty, rty := typeOf(lhs), typeOf(rhs)
+	if lty.IsArithmetic() && rty.IsArithmetic() {
+		return NewNode(Add, lhs, rhs), nil
+	}
+	if rty.hasBase() && lty.IsInteger() { // 整数 + ポインタ は ポインタ + 整数 に並べ替える
+		lhs, rhs = rhs, lhs
+		lty, rty = rty, lty
+	}
+	if !lty.hasBase() || !rty.IsInteger() {
+		return nil, p.errorAt(tok, "invalid operands to binary + (%s and %s)", lty.Kind, rty.Kind)
+	}
+	node := NewNode(Add, lhs, p.scaleByBase(rhs, lty))
+	node.Type = PointerTo(lty.Base)
+	return node, nil
+}
+
+// lhs - rhs を表すNodeを返す。ポインタから整数を引く場合は、整数に指す先の型のサイズを掛ける。
+// ポインタ同士の差は、間にある要素の個数になる。tokはエラー表示に使う
+func (p *TParser) newSub(lhs, rhs *Node, tok *Token) (*Node, error) {
+	lty, rty := typeOf(lhs), typeOf(rhs)
+	if lty.IsArithmetic() && rty.IsArithmetic() {
+		return NewNode(Sub, lhs, rhs), nil
+	}
+	if lty.hasBase() && rty.IsInteger() {
+		node := NewNode(Sub, lhs, p.scaleByBase(rhs, lty))
+		node.Type = PointerTo(lty.Base)
+		return node, nil
+	}
+	if lty.hasBase() && rty.hasBase() {
+		diff := NewNode(Sub, lhs, rhs)
+		diff.Type = LongType
+		return NewNode(Div, diff, &Node{Kind: Num, Value: lty.Base.Size, Type: LongType}), nil
+	}
+	return nil, p.errorAt(tok, "invalid operands to binary - (%s and %s)", lty.Kind, rty.Kind)
+}
+
+// 整数のnodeに、ポインタ型ptrが指す先の型のサイズを掛けたNodeを返す
+func (p *TParser) scaleByBase(node *Node, ptr *Type) *Node {
+	return NewNode(Mul, node, &Node{Kind: Num, Value: ptr.Base.Size, Type: LongType})
+}
+
 func (p *TParser) mul() (*Node, error) {
 	node, err := p.unary()
 	if err != nil {
 		return nil, err
 	}
 	if p.consume("*") {
-		rhs, err := p.primary()
+		rhs, err := p.unary()
 		if err != nil {
 			return nil, err
 		}
 		node = NewNode(Mul, node, rhs)
 	}
 	if p.consume("/") {
-		rhs, err := p.primary()
+		rhs, err := p.unary()
 		if err != nil {
 			return nil, err
 		}
@@ -222,17 +492,23 @@ func (p *TParser) mul() (*Node, error) {
 }
 
 func (p *TParser) unary() (*Node, error) {
+	if tok := p.token; p.token.next != nil && p.isTypeName(p.token.next) && p.consume("(") {
+		return p.cast(tok)
+	}
 	if p.consume("+") {
-		node, err := p.primary()
+		node, err := p.unary()
 		if err != nil {
-			xerrors.Errorf("failed to parse unary: %w", err)
+			return nil, xerrors.Errorf("failed to parse unary: %w", err)
 		}
 		return node, nil
 	}
 	if p.consume("-") {
-		node, err := p.primary()
+		node, err := p.unary()
 		if err != nil {
-			xerrors.Errorf("failed to parse unary: %w", err)
+			return nil, xerrors.Errorf("failed to parse unary: %w", err)
+		}
+		if ty := typeOf(node); ty != nil && ty.IsFlonum() {
+			return NewNode(Neg, node, nil), nil // 0-xでは-0.0の符号が失われるので、符号bitを反転する
 		}
 		zero := &Node{
 			Kind:  Num,
@@ -240,14 +516,309 @@ func (p *TParser) unary() (*Node, error) {
 		}
 		return NewNode(Sub, zero, node), nil
 	}
+	if tok := p.token; p.consume("sizeof") {
+		return p.sizeof(tok)
+	}
+	if tok := p.token; p.consume("_Alignof") {
+		return p.alignof(tok)
+	}
+	if tok := p.token; p.consume("&") {
+		node, err := p.unary()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse unary: %w", err)
+		}
+		if isBitfield(node) {
+			return nil, p.errorAt(tok, "address of bit-field requested")
+		}
+		return NewNode(Addr, node, nil), nil
+	}
+	if tok := p.token; p.consume("*") {
+		node, err := p.unary()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse unary: %w", err)
+		}
+		return p.newDeref(node, tok)
+	}
+	node, err := p.postfix()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse unary: %w", err)
+	}
+	return node, nil
+}
+
+// "sizeof" の直後から、sizeof式をparseする。値はコンパイル時に決まるので、unsigned long型の定数になる。
+// tokはエラー表示に使う
+func (p *TParser) sizeof(tok *Token) (*Node, error) {
+	ty, err := p.typeOperand(tok, "sizeof")
+	if err != nil {
+		return nil, err
+	}
+	return &Node{Kind: Num, Value: ty.Size, Type: ULongType}, nil
+}
+
+// "_Alignof" の直後から、_Alignof式をparseする。sizeofと同じくunsigned long型の定数になる。
+// gccと同じく、型名の代わりに式を書くとその式の型のアラインメントになる。tokはエラー表示に使う
+func (p *TParser) alignof(tok *Token) (*Node, error) {
+	ty, err := p.typeOperand(tok, "_Alignof")
+	if err != nil {
+		return nil, err
+	}
+	return &Node{Kind: Num, Value: ty.Align, Type: ULongType}, nil
+}
+
+// sizeofまたは_Alignofの演算子opの、括弧で囲まれた型名または式のオペランドをparseし、その型を返す。
+// tokはエラー表示に使う
+func (p *TParser) typeOperand(tok *Token, op string) (*Type, error) {
+	var ty *Type
+	if p.token.kind == TKReserved && p.token.str == "(" && p.isTypeName(p.token.next) {
+		p.consume("(")
+		var err error
+		if ty, err = p.typeName(); err != nil {
+			return nil, xerrors.Errorf("failed to parse %s: %w", op, err)
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, xerrors.Errorf("failed to parse %s: %w", op, err)
+		}
+	} else {
+		node, err := p.unary()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse %s: %w", op, err)
+		}
+		if isBitfield(node) {
+			return nil, p.errorAt(tok, "invalid application of '%s' to bit-field", op)
+		}
+		ty = typeOf(node) // 配列はポインタに読み替えずに配列全体の型を使う
+	}
+	if !ty.IsComplete() {
+		return nil, p.errorAt(tok, "invalid application of '%s' to an incomplete type %s", op, ty.Kind)
+	}
+	return ty, nil
+}
+
+// "(" の直後から、"(" type-name ")" unary の形のキャスト式をparseする。tokはエラー表示に使う
+func (p *TParser) cast(tok *Token) (*Node, error) {
+	ty, err := p.typeName()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse cast: %w", err)
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, xerrors.Errorf("failed to parse cast: %w", err)
+	}
+	if p.token.kind == TKReserved && p.token.str == "{" {
+		node, err := p.compoundLiteral(tok, ty)
+		if err != nil {
+			return nil, err
+		}
+		return p.postfixOps(node)
+	}
+	node, err := p.unary()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse cast: %w", err)
+	}
+	if ty.IsAggregate() || ty.Kind == TyArray || ty.Kind == TyFunc {
+		return nil, p.errorAt(tok, "cannot cast to %s type; scalar type is required", ty.Kind)
+	}
+	from := typeOf(node)
+	if from.IsAggregate() {
+		return nil, p.errorAt(tok, "cannot cast from %s type; scalar type is required", from.Kind)
+	}
+	if isPointerFlonumPair(ty, from) {
+		return nil, p.errorAt(tok, "cannot cast from %s type to %s type", from.Kind, ty.Kind)
+	}
+	return &Node{Kind: Cast, Lhs: node, Type: ty}, nil
+}
+
+// 一方がポインタ型で他方が浮動小数点数型であるときtrueを返す。これらの型の間では変換できない
+func isPointerFlonumPair(t1, t2 *Type) bool {
+	return t1.Kind == TyPtr && t2.IsFlonum() || t1.IsFlonum() && t2.Kind == TyPtr
+}
+
+// compoundLiteral = "(" typeName ")" initializer
+//
+// "(" typeName ")" の直後から複合リテラルの初期化子をparseする。tokは "(" のトークンで、エラー表示に使う。
+// 複合リテラルは名前のないローカル変数として確保し、初期化した後にその変数を値とするNodeを返す
+func (p *TParser) compoundLiteral(tok *Token, ty *Type) (*Node, error) {
+	if ty.Kind == TyFunc || !ty.IsComplete() && !(ty.Kind == TyArray && ty.Base.IsComplete()) {
+		return nil, p.errorAt(tok, "compound literal has incomplete type %s", ty.Kind)
+	}
+	init, err := p.initializer(ty)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse compound literal. cause:\n%w", err)
+	}
+	lvar := p.newLVar("", init.ty)
+	return &Node{
+		Kind: Comma,
+		Lhs:  &Node{Kind: Block, Body: lvarInitializer(lvar, init)},
+		Rhs:  lvarAt(lvar, 0, init.ty),
+	}, nil
+}
+
+// postfix = primary postfixOps
+//
+// 複合リテラルは型名の括弧を読むまでキャストと区別できないので、castから読む
+func (p *TParser) postfix() (*Node, error) {
 	node, err := p.primary()
 	if err != nil {
-		xerrors.Errorf("failed to parse unary: %w", err)
+		return nil, err
+	}
+	return p.postfixOps(node)
+}
+
+// postfixOps = ("[" expr "]" | "." ident | "->" ident | "(" funcArgs)*
+//
+// nodeに続く添字、メンバーアクセス、関数呼び出しをparseする
+func (p *TParser) postfixOps(node *Node) (*Node, error) {
+	var err error
+	for {
+		if tok := p.token; p.consume("[") { // a[i] は *(a+i) として扱う
+			idx, err := p.expr()
+			if err != nil {
+				return nil, xerrors.Errorf("failed to parse array subscript. cause:\n%w", err)
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, xerrors.Errorf("failed to parse array subscript. cause:\n%w", err)
+			}
+			if node, err = p.newAdd(node, idx, tok); err != nil {
+				return nil, err
+			}
+			if node, err = p.newDeref(node, tok); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if tok := p.token; p.consume(".") {
+			node, err = p.memberAccess(node, tok)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if tok := p.token; p.consume("->") {
+			node, err = p.newDeref(node, tok)
+			if err != nil {
+				return nil, err
+			}
+			node, err = p.memberAccess(node, tok)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if tok := p.token; p.consume("(") {
+			node, err = p.funcCall(node, tok)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return node, nil
+	}
+}
+
+// 関数呼び出しで渡せる引数の数の上限。スタックで渡す引数には対応していないので、
+// System V ABIの引数レジスタ(整数はrdi, rsi, rdx, rcx, r8, r9、浮動小数点数はxmm0〜xmm7)の数までになる
+const (
+	maxIntArgs   = 6
+	maxFloatArgs = 8
+)
+
+// funcArgs = (assign ("," assign)*)? ")"
+//
+// "(" の直後から実引数をparseし、関数または関数へのポインタの値fnを呼び出すNodeを返す。tokはエラー表示に使う。
+// 引数の型が分かっている関数では、実引数の数と、それぞれの実引数を引数に代入できることを確かめる
+func (p *TParser) funcCall(fn *Node, tok *Token) (*Node, error) {
+	fty := calleeType(typeOf(fn))
+	if fty == nil {
+		return nil, p.errorAt(tok, "called object type %s is not a function or function pointer", typeOf(fn).Kind)
+	}
+	if fty.Return.IsAggregate() {
+		return nil, p.errorAt(tok, "calling a function returning %s is not supported", fty.Return.Kind)
+	}
+	node := &Node{Kind: Call, Lhs: fn, Type: fty.Return.Unqualified()}
+	ints, floats := 0, 0
+	for i := 0; !p.consume(")"); i++ {
+		if i > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, xerrors.Errorf("failed to parse arguments of function call. cause:\n%w", err)
+			}
+		}
+		argTok := p.token
+		arg, err := p.assign()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse arguments of function call. cause:\n%w", err)
+		}
+		aty := typeOf(arg)
+		if aty.IsAggregate() {
+			return nil, p.errorAt(argTok, "passing %s arguments is not supported", aty.Kind)
+		}
+		if i < len(fty.Params) {
+			if err := p.checkAssignable(argTok, fty.Params[i], aty); err != nil {
+				return nil, err
+			}
+		}
+		if aty.IsFlonum() {
+			floats++
+		} else {
+			ints++
+		}
+		if ints > maxIntArgs || floats > maxFloatArgs {
+			return nil, p.errorAt(argTok, "too many arguments; at most %d integer and %d floating-point arguments are supported", maxIntArgs, maxFloatArgs)
+		}
+		node.Body = append(node.Body, arg)
+	}
+	if len(fty.Params) > 0 && len(node.Body) != len(fty.Params) {
+		return nil, p.errorAt(tok, "function call expects %d arguments but got %d", len(fty.Params), len(node.Body))
 	}
 	return node, nil
 }
 
+// nodeがビットフィールドのメンバーを表すときtrueを返す
+func isBitfield(node *Node) bool {
+	return node.Kind == MemberAccess && node.Member.IsBitfield
+}
+
+// ポインタ値のnodeが指す先を表すNodeを返す。tokはエラー表示に使う。
+// 関数はそれを指すポインタに読み替えられるので、関数のnodeはそのまま返す
+func (p *TParser) newDeref(node *Node, tok *Token) (*Node, error) {
+	ty := typeOf(node)
+	if ty.Kind == TyFunc {
+		return node, nil
+	}
+	if !ty.hasBase() {
+		return nil, p.errorAt(tok, "indirection requires pointer operand (%s invalid)", ty.Kind)
+	}
+	deref := NewNode(Deref, node, nil)
+	deref.Type = ty.Base
+	return deref, nil
+}
+
+// 構造体または共用体の値のnodeの、現在のトークンが示すメンバーを表すNodeを返す。tokはエラー表示に使う
+func (p *TParser) memberAccess(node *Node, tok *Token) (*Node, error) {
+	ty := typeOf(node)
+	if !ty.IsAggregate() {
+		return nil, p.errorAt(tok, "member reference base type %s is not a structure or union", ty.Kind)
+	}
+	if p.token.kind != TKIDENT {
+		return nil, p.errorAt(p.token, "expect member name but got %q", p.token.str)
+	}
+	member := ty.findMember(p.token.str)
+	if member == nil {
+		return nil, p.errorAt(p.token, "no member named %q in %s", p.token.str, ty.Kind)
+	}
+	p.token = p.token.next
+	p.pos++
+	return &Node{
+		Kind:   MemberAccess,
+		Lhs:    node,
+		Member: member,
+		Type:   qualify(member.Type, qualifiersOf(ty)), // const修飾された構造体のメンバーはconst修飾される
+	}, nil
+}
+
 func (p *TParser) primary() (*Node, error) {
+	if tok := p.token; tok.next != nil && tok.next.kind == TKReserved && tok.next.str == "{" && p.consume("(") {
+		return p.stmtExpr(tok)
+	}
 	if p.consume("(") {
 		e, err := p.add()
 		if err != nil {
@@ -258,9 +829,18 @@ func (p *TParser) primary() (*Node, error) {
 		}
 		return nil, xerrors.Errorf("token ')' is missing in (expr), got %q", p.token.str)
 	}
+	if tok := p.token; tok.kind == TKIDENT && p.findSymbol(tok.str) == nil {
+		// 組み込み関数とメモリオーダーの名前は、同じ名前の変数が宣言されていなければ組み込みのものとして扱う
+		if node, ok, err := p.builtin(tok); ok {
+			return node, err
+		}
+	}
 	if node, ok := p.parseIfIdentifier(); ok {
 		return node, nil
 	}
+	if tok := p.token; p.consume("_Generic") {
+		return p.genericSelection(tok)
+	}
 	node, err := p.expectNumber()
 	if err != nil {
 		return nil, err
@@ -276,34 +856,83 @@ func (p *TParser) parseIfIdentifier() (*Node, bool) {
 	if len(name) == 0 {
 		return nil, false
 	}
-	// 初めて現れたローカル変数名である場合は登録する
-	lvar := p.findLVar(p.token)
-	if lvar == nil {
-		newLVar := &LVar{
-			name:   name,
-			len:    len(name),
-			next:   p.lvar,
-			offset: p.lvar.offset + 8,
-		}
-		p.lvar = newLVar
-		lvar = newLVar
+	var lvar *LVar
+	switch sym := p.findSymbol(name); {
+	case sym == nil:
+		// 宣言されずに初めて現れたローカル変数名である場合は、関数全体のスコープにlong型の変数として登録する
+		lvar = p.newLVar(name, LongType)
+		p.scopes[0].symbols[name] = &symbol{kind: symVar, lvar: lvar}
+	case sym.kind == symEnumConst:
+		// 列挙定数はコンパイル時に値が決まるので、変数ではなく数値として扱う
+		p.token = p.token.next
+		return newNumber(sym.val), true
+	case sym.kind == symTypedef:
+		return nil, false
+	case sym.gvar != nil:
+		p.token = p.token.next
+		return &Node{
+			Kind: GlobalVar,
+			Name: name,
+			Type: sym.gvar.Type,
+			Var:  sym.gvar,
+		}, true
+	default:
+		lvar = sym.lvar
 	}
 	p.token = p.token.next
 	return &Node{
 		Kind:   LocalVar,
 		Name:   name,
 		Offset: lvar.offset,
+		Type:   lvar.ty,
 	}, true
 }
 
+// 型tyのローカル変数のスタック領域を確保する。名前はスコープに登録しない
+func (p *TParser) newLVar(name string, ty *Type) *LVar {
+	lvar := &LVar{
+		name:   name,
+		len:    len(name),
+		next:   p.lvar,
+		offset: alignTo(p.lvar.offset+ty.Size, ty.Align),
+		ty:     ty,
+	}
+	p.lvar = lvar
+	return lvar
+}
+
+// string+
+//
+// 並んだ文字列リテラルを読み、エスケープシーケンスを解釈して連結した内容を返す
+func (p *TParser) stringLiteral() (string, error) {
+	if p.token.kind != TKStr {
+		return "", p.errorAt(p.token, "expect string literal but got %q", p.token.str)
+	}
+	var s string
+	for p.token.kind == TKStr {
+		str, err := unquote(p.token.str)
+		if err != nil {
+			return "", p.errorAt(p.token, "%v", err)
+		}
+		s += str
+		p.token = p.token.next
+		p.pos++
+	}
+	return s, nil
+}
+
 func (p *TParser) expectNumber() (*Node, error) {
 	if p.token.kind != TKNum {
-		return nil, xerrors.Errorf("expect number but token %+v", *p.token)
+		return nil, p.errorAt(p.token, "expect number but got %q", p.token.str)
 	}
 	node := &Node{
 		Kind:  Num,
 		Value: p.token.val,
 	}
+	if p.token.ty != nil {
+		node.FVal = p.token.fval
+		node.Type = p.token.ty
+	}
 	p.token = p.token.next
 	p.pos++
 	return node, nil
@@ -311,25 +940,231 @@ func (p *TParser) expectNumber() (*Node, error) {
 
 func (p *TParser) expect(s string) error {
 	if !p.consume(s) {
-		return xerrors.Errorf("expect %q but got %v", s, p.token)
+		return p.errorAt(p.token, "expect %q but got %q", s, p.token.str)
 	}
 	return nil
 }
 
-// 指定されたtokenに合致するローカル変数をすでに定義されたローカル変数から検索する。
-// 存在しなければnilを返す。
-func (p *TParser) findLVar(token *Token) *LVar {
-	if token.kind != TKIDENT {
-		return nil
+// "{" の直後から "}" までの文をparseする
+func (p *TParser) compoundStmt() (*Node, error) {
+	node := &Node{Kind: Block}
+	for !p.consume("}") {
+		if p.token.kind == TKEOF {
+			return nil, p.errorAt(p.token, "block is not closed by '}'")
+		}
+		stmt, err := p.stmt()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse block. cause:\n%w", err)
+		}
+		node.Body = append(node.Body, stmt)
+	}
+	return node, nil
+}
+
+// genericSelection    = "_Generic" "(" assign ("," genericAssociation)+ ")"
+// genericAssociation = (typeName | "default") ":" assign
+//
+// "_Generic" の直後から総称選択をparseし、制御式の型と互換な型名の式を返す。
+// 制御式の型は左辺値変換した後の型で、互換な型名がなければdefaultの式を返す。
+// 選ばれなかった式と制御式は評価しない。tokはエラー表示に使う
+func (p *TParser) genericSelection(tok *Token) (*Node, error) {
+	if err := p.expect("("); err != nil {
+		return nil, xerrors.Errorf("failed to parse _Generic. cause:\n%w", err)
+	}
+	ctrl, err := p.assign()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse controlling expression of _Generic. cause:\n%w", err)
+	}
+	cty := lvalueConverted(typeOf(ctrl))
+	var selected, def *Node
+	var types []*Type
+	for !p.consume(")") {
+		if err := p.expect(","); err != nil {
+			return nil, xerrors.Errorf("failed to parse _Generic. cause:\n%w", err)
+		}
+		assocTok := p.token
+		var ty *Type
+		if !p.consume("default") {
+			if ty, err = p.typeName(); err != nil {
+				return nil, xerrors.Errorf("failed to parse generic association. cause:\n%w", err)
+			}
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, xerrors.Errorf("failed to parse generic association. cause:\n%w", err)
+		}
+		expr, err := p.assign()
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse generic association. cause:\n%w", err)
+		}
+		if ty == nil {
+			if def != nil {
+				return nil, p.errorAt(assocTok, "duplicate default generic association")
+			}
+			def = expr
+			continue
+		}
+		for _, t := range types {
+			if isCompatible(t, ty) {
+				return nil, p.errorAt(assocTok, "type %s in generic association compatible with previously specified type", qualifiedName(ty))
+			}
+		}
+		types = append(types, ty)
+		if isCompatible(cty, ty) {
+			selected = expr
+		}
+	}
+	if len(types) == 0 && def == nil {
+		return nil, p.errorAt(tok, "expected generic association")
+	}
+	if selected == nil {
+		selected = def
+	}
+	if selected == nil {
+		return nil, p.errorAt(tok, "controlling expression type %s not compatible with any generic association type", qualifiedName(cty))
+	}
+	return selected, nil
+}
+
+// 値を持たない文式
+type voidStmtExpr struct {
+	node *Node
+	tok  *Token // 文式の "(" のトークン。エラー表示に使う
+}
+
+// stmtExpr = "(" "{" stmt* "}" ")"
+//
+// GNU拡張の文式をparseする。tokは "(" のトークンで、エラー表示に使う。
+// 文式の値は最後の式文の値になる。最後の文が式文でない文式はvoid型になり、値を使うとエラーになる
+func (p *TParser) stmtExpr(tok *Token) (*Node, error) {
+	p.consume("{")
+	p.enterScope()
+	block, err := p.compoundStmt()
+	p.leaveScope()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse statement expression. cause:\n%w", err)
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, xerrors.Errorf("failed to parse statement expression. cause:\n%w", err)
+	}
+	node := &Node{Kind: StmtExpr, Body: block.Body}
+	if len(block.Body) == 0 || typeOf(block.Body[len(block.Body)-1]) == nil {
+		node.Type = VoidType
+		p.voidStmtExprs = append(p.voidStmtExprs, voidStmtExpr{node: node, tok: tok})
 	}
-	lvar := p.lvar
-	for lvar != nil {
-		if lvar.name == token.str {
-			return lvar
+	return node, nil
+}
+
+// 式文全体であるnodeが値を持たない文式であれば、値は使われないので値を使っていないことを記録する
+func (p *TParser) discardVoidStmtExpr(node *Node) {
+	for i, v := range p.voidStmtExprs {
+		if v.node == node {
+			p.voidStmtExprs = append(p.voidStmtExprs[:i], p.voidStmtExprs[i+1:]...)
+			return
 		}
-		lvar = lvar.next
 	}
-	return nil
+}
+
+// "switch" の直後から switch文をparseする。tokはエラー表示に使う
+func (p *TParser) switchStmt(tok *Token) (*Node, error) {
+	if err := p.expect("("); err != nil {
+		return nil, xerrors.Errorf("failed to parse switch statement. cause:\n%w", err)
+	}
+	cond, err := p.expr()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse switch statement. cause:\n%w", err)
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, xerrors.Errorf("failed to parse switch statement. cause:\n%w", err)
+	}
+	if ty := typeOf(cond); !ty.IsInteger() {
+		return nil, p.errorAt(tok, "statement requires expression of integer type (%s invalid)", ty.Kind)
+	}
+	node := &Node{Kind: Switch, Lhs: cond, Label: p.newLabel("break")}
+
+	outer := p.curSwitch
+	p.curSwitch = node
+	p.brkLabels = append(p.brkLabels, node.Label)
+	body, err := p.stmt()
+	p.brkLabels = p.brkLabels[:len(p.brkLabels)-1]
+	p.curSwitch = outer
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse switch statement. cause:\n%w", err)
+	}
+	node.Rhs = body
+	return node, nil
+}
+
+// "do" の直後から do-while文をparseする
+func (p *TParser) doWhileStmt() (*Node, error) {
+	node := &Node{Kind: DoWhile, Label: p.newLabel("break"), ContLabel: p.newLabel("continue")}
+
+	p.brkLabels = append(p.brkLabels, node.Label)
+	p.contLabels = append(p.contLabels, node.ContLabel)
+	body, err := p.stmt()
+	p.brkLabels = p.brkLabels[:len(p.brkLabels)-1]
+	p.contLabels = p.contLabels[:len(p.contLabels)-1]
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse do-while statement. cause:\n%w", err)
+	}
+	node.Lhs = body
+
+	if err := p.expect("while"); err != nil {
+		return nil, xerrors.Errorf("failed to parse do-while statement. cause:\n%w", err)
+	}
+	if err := p.expect("("); err != nil {
+		return nil, xerrors.Errorf("failed to parse do-while statement. cause:\n%w", err)
+	}
+	cond, err := p.expr()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse do-while statement. cause:\n%w", err)
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, xerrors.Errorf("failed to parse do-while statement. cause:\n%w", err)
+	}
+	if err := p.expect(";"); err != nil {
+		return nil, xerrors.Errorf("failed to parse do-while statement. cause:\n%w", err)
+	}
+	node.Rhs = cond
+	return node, nil
+}
+
+// prefixを含むユニークなアセンブリ上のラベル名を返す
+func (p *TParser) newLabel(prefix string) string {
+	p.labelCount++
+	return fmt.Sprintf(".L.%s.%d", prefix, p.labelCount)
+}
+
+// 現在のトークンが "ident :" の形のラベルの始まりであるときtrueを返す
+func (p *TParser) isLabel() bool {
+	if p.token.kind != TKIDENT {
+		return false
+	}
+	next := p.token.next
+	return next.kind == TKReserved && next.str == ":"
+}
+
+// ソースコード上のラベル名に対応するアセンブリ上のラベル名を返す
+func labelName(name string) string {
+	return ".L.label." + name
+}
+
+// tokの位置を "行:列: " の形で先頭に付けたエラーを返す
+func (p *TParser) errorAt(tok *Token, format string, a ...interface{}) error {
+	return xerrors.Errorf("%s: %s", position(p.src, tok.pos), fmt.Sprintf(format, a...))
+}
+
+// ソースコードsrcの先頭からrune単位でpos番目の位置を "行:列" の形式で返す
+func position(src []rune, pos int) string {
+	line, col := 1, 1
+	for _, r := range src[:pos] {
+		if r == '\n' {
+			line++
+			col = 1
+			continue
+		}
+		col++
+	}
+	return fmt.Sprintf("%d:%d", line, col)
 }
 
 func (p *TParser) consumeReturn() bool {
@@ -347,4 +1182,5 @@ type LVar struct {
 	len    int    // nameの長さ
 	offset int    // 変数に割り当てるスタック領域のBase Pointerからのoffset
 	next   *LVar  // 1つ前に定義されたLVarへのポインタ
+	ty     *Type  // 変数の型
 }
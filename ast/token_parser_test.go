@@ -1,6 +1,7 @@
 package ast_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -279,6 +280,7 @@ func TestTParser(t *testing.T) {
 					Kind:   ast.LocalVar,
 					Name:   "a",
 					Offset: 8,
+					Type:   ast.LongType,
 				},
 				Rhs: &ast.Node{
 					Kind:  ast.Num,
@@ -393,6 +395,365 @@ func TestTParser_Program(t *testing.T) {
 				},
 			},
 		},
+		{
+			title:  "goto and label",
+			source: "goto end;end:1;",
+			expect: []*ast.Node{
+				{
+					Kind:  ast.Goto,
+					Name:  "end",
+					Label: ".L.label.end",
+				},
+				{
+					Kind:  ast.Label,
+					Name:  "end",
+					Label: ".L.label.end",
+					Lhs: &ast.Node{
+						Kind:  ast.Num,
+						Value: 1,
+					},
+				},
+			},
+		},
+		{
+			title:  "goto undefined label",
+			source: "goto end;1;",
+			retErr: true,
+		},
+		{
+			title:  "switch",
+			source: "switch(1){case 2:3;}",
+			expect: func() []*ast.Node {
+				c := &ast.Node{
+					Kind:  ast.Case,
+					Value: 2,
+					Label: ".L.case.2",
+					Lhs: &ast.Node{
+						Kind:  ast.Num,
+						Value: 3,
+					},
+				}
+				return []*ast.Node{
+					{
+						Kind:  ast.Switch,
+						Label: ".L.break.1",
+						Lhs: &ast.Node{
+							Kind:  ast.Num,
+							Value: 1,
+						},
+						Rhs: &ast.Node{
+							Kind: ast.Block,
+							Body: []*ast.Node{c},
+						},
+						Cases: []*ast.Node{c},
+					},
+				}
+			}(),
+		},
+		{
+			title:  "duplicate case value",
+			source: "switch(1){case 2:3;case 1+1:4;}",
+			retErr: true,
+		},
+		{
+			title:  "non-constant case value",
+			source: "switch(1){case a:3;}",
+			retErr: true,
+		},
+		{
+			title:  "multiple default labels",
+			source: "switch(1){default:3;default:4;}",
+			retErr: true,
+		},
+		{
+			title:  "do-while",
+			source: "do continue;while(1);",
+			expect: []*ast.Node{
+				{
+					Kind:      ast.DoWhile,
+					Label:     ".L.break.1",
+					ContLabel: ".L.continue.2",
+					Lhs: &ast.Node{
+						Kind:  ast.Continue,
+						Label: ".L.continue.2",
+					},
+					Rhs: &ast.Node{
+						Kind:  ast.Num,
+						Value: 1,
+					},
+				},
+			},
+		},
+		{
+			title:  "do without while",
+			source: "do 1;",
+			retErr: true,
+		},
+		{
+			title:  "member access to non-struct",
+			source: "a.x;",
+			retErr: true,
+		},
+		{
+			title:  "unknown member",
+			source: "struct {int x;} s;s.y;",
+			retErr: true,
+		},
+		{
+			title:  "dereference of non-pointer",
+			source: "int a;*a;",
+			retErr: true,
+		},
+		{
+			title:  "assign int to struct",
+			source: "struct {int x;} s;s=1;",
+			retErr: true,
+		},
+		{
+			title:  "assign different struct types",
+			source: "struct {int x;} s;struct {int x;} t;s=t;",
+			retErr: true,
+		},
+		{
+			title:  "variable of incomplete struct type",
+			source: "struct node n;",
+			retErr: true,
+		},
+		{
+			title:  "redefinition of struct",
+			source: "struct s {int x;};struct s {int y;};",
+			retErr: true,
+		},
+		{
+			title:  "duplicate member",
+			source: "struct {int x;int x;} s;",
+			retErr: true,
+		},
+		{
+			title:  "redefinition of variable",
+			source: "int a;int a;",
+			retErr: true,
+		},
+		{
+			title:  "enum constant",
+			source: "enum {A, B=5, C};C;",
+			expect: []*ast.Node{
+				{Kind: ast.Block},
+				{
+					Kind:  ast.Num,
+					Value: 6,
+				},
+			},
+		},
+		{
+			title:  "redefinition of enum constant",
+			source: "enum {A};enum {A};",
+			retErr: true,
+		},
+		{
+			title:  "enum constant conflicts with variable",
+			source: "a=1;enum {a};",
+			retErr: true,
+		},
+		{
+			title:  "non-constant enumerator value",
+			source: "enum {A=b};",
+			retErr: true,
+		},
+		{
+			title:  "undeclared enum",
+			source: "enum e x;",
+			retErr: true,
+		},
+		{
+			title:  "tag used as different kind",
+			source: "struct t {int x;};union t u;",
+			retErr: true,
+		},
+		{
+			title:  "typedef",
+			source: "typedef int T;T a;a;",
+			expect: []*ast.Node{
+				{Kind: ast.Block},
+				{Kind: ast.Block},
+				{
+					Kind: ast.GlobalVar,
+					Name: "a",
+					Type: ast.IntType,
+					Var:  &ast.GVar{Label: ".L.global.a.1", Name: "a", Type: ast.IntType},
+				},
+			},
+		},
+		{
+			title:  "variable shadowing in block",
+			source: "int a;{int a;a;}a;",
+			expect: []*ast.Node{
+				{Kind: ast.Block},
+				{
+					Kind: ast.Block,
+					Body: []*ast.Node{
+						{Kind: ast.Block},
+						{
+							Kind:   ast.LocalVar,
+							Name:   "a",
+							Offset: 4,
+							Type:   ast.IntType,
+						},
+					},
+				},
+				{
+					Kind: ast.GlobalVar,
+					Name: "a",
+					Type: ast.IntType,
+					Var:  &ast.GVar{Label: ".L.global.a.1", Name: "a", Type: ast.IntType},
+				},
+			},
+		},
+		{
+			title:  "array initializer with designator",
+			source: "{int a[2] = {[1] = 5};}",
+			expect: []*ast.Node{
+				{
+					Kind: ast.Block,
+					Body: []*ast.Node{
+						{
+							Kind: ast.Block,
+							Body: []*ast.Node{
+								{
+									Kind: ast.MemZero,
+									Lhs: &ast.Node{
+										Kind:   ast.LocalVar,
+										Name:   "a",
+										Offset: 8,
+										Type:   ast.ArrayOf(ast.IntType, 2),
+									},
+								},
+								{
+									Kind: ast.Assign,
+									Lhs: &ast.Node{
+										Kind:   ast.LocalVar,
+										Name:   "a",
+										Offset: 4,
+										Type:   ast.IntType,
+									},
+									Rhs: &ast.Node{
+										Kind:  ast.Num,
+										Value: 5,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			title:  "pointer addition is scaled by pointee size",
+			source: "int *p;p+1;",
+			expect: []*ast.Node{
+				{Kind: ast.Block},
+				{
+					Kind: ast.Add,
+					Type: ast.PointerTo(ast.IntType),
+					Lhs: &ast.Node{
+						Kind: ast.GlobalVar,
+						Name: "p",
+						Type: ast.PointerTo(ast.IntType),
+						Var:  &ast.GVar{Label: ".L.global.p.1", Name: "p", Type: ast.PointerTo(ast.IntType)},
+					},
+					Rhs: &ast.Node{
+						Kind: ast.Mul,
+						Lhs: &ast.Node{
+							Kind:  ast.Num,
+							Value: 1,
+						},
+						Rhs: &ast.Node{
+							Kind:  ast.Num,
+							Value: 4,
+							Type:  ast.LongType,
+						},
+					},
+				},
+			},
+		},
+		{
+			title:  "sizeof array",
+			source: "int a[2][3];sizeof a[1];",
+			expect: []*ast.Node{
+				{Kind: ast.Block},
+				{
+					Kind:  ast.Num,
+					Value: 12,
+					Type:  ast.ULongType,
+				},
+			},
+		},
+		{
+			title:  "static local variable",
+			source: "static int x;x;",
+			expect: []*ast.Node{
+				{Kind: ast.Block},
+				{
+					Kind: ast.GlobalVar,
+					Name: "x",
+					Type: ast.IntType,
+					Var:  &ast.GVar{Label: ".L.static.x.1", Type: ast.IntType},
+				},
+			},
+		},
+		{
+			title:  "extern variable",
+			source: "extern long x;x;",
+			expect: []*ast.Node{
+				{Kind: ast.Block},
+				{
+					Kind: ast.GlobalVar,
+					Name: "x",
+					Type: ast.LongType,
+					Var:  &ast.GVar{Label: "x", Type: ast.LongType, Extern: true},
+				},
+			},
+		},
+		{
+			title:  "variable redefines typedef name",
+			source: "typedef int T;int T;",
+			retErr: true,
+		},
+		{
+			title:  "typedef redefines variable",
+			source: "int T;typedef int T;",
+			retErr: true,
+		},
+		{
+			title:  "typedef name used as expression",
+			source: "typedef int T;1+T;",
+			retErr: true,
+		},
+		{
+			title:  "struct tag is not visible outside block",
+			source: "{struct s {int a;};}struct s x;",
+			retErr: true,
+		},
+		{
+			title:  "case outside switch",
+			source: "case 1:2;",
+			retErr: true,
+		},
+		{
+			title:  "duplicate label",
+			source: "end:1;end:2;",
+			retErr: true,
+		},
+		{
+			title:  "break outside loop",
+			source: "break;",
+			retErr: true,
+		},
+		{
+			title:  "continue outside loop",
+			source: "continue;",
+			retErr: true,
+		},
 	}
 	for _, tt := range testcases {
 		t.Run(tt.title, func(t *testing.T) {
@@ -410,3 +771,841 @@ func TestTParser_Program(t *testing.T) {
 		})
 	}
 }
+
+func TestTParser_ErrorPosition(t *testing.T) {
+	testcases := [...]struct {
+		title  string
+		source string
+		expect string
+	}{
+		{
+			title:  "break outside loop",
+			source: "a=1; break;",
+			expect: "1:6: break statement not within loop or switch",
+		},
+		{
+			title:  "continue outside loop",
+			source: "continue;",
+			expect: "1:1: continue statement not within a loop",
+		},
+		{
+			title:  "goto undefined label",
+			source: "a=1;goto end;",
+			expect: `1:10: label "end" used but not defined`,
+		},
+		{
+			title:  "duplicate case value",
+			source: "switch(1){case 2:3;case 2:4;}",
+			expect: "1:20: duplicate case value 2",
+		},
+		{
+			title:  "duplicate case value after conversion",
+			source: "unsigned x=1;switch(x){case -1:3;case 4294967295:4;}",
+			expect: "1:34: duplicate case value 4294967295",
+		},
+		{
+			title:  "while without do",
+			source: "a=0;while(a)a=a-1;",
+			expect: "1:5: while loop is not supported; use do-while instead",
+		},
+		{
+			title:  "cast to struct",
+			source: "struct s {int a;} x;(struct s)1;",
+			expect: "1:21: cannot cast to struct type; scalar type is required",
+		},
+		{
+			title:  "cast from struct",
+			source: "struct s {int a;} x;1+(long)x;",
+			expect: "1:23: cannot cast from struct type; scalar type is required",
+		},
+		{
+			title:  "excess array initializer",
+			source: "int a[2] = {1, 2, 3};",
+			expect: "1:19: excess elements in array initializer",
+		},
+		{
+			title:  "array designator out of bounds",
+			source: "int a[2] = {[2] = 1};",
+			expect: "1:13: array designator index 2 exceeds array bounds",
+		},
+		{
+			title:  "unknown field designator",
+			source: "struct {int x;} s = {.y = 1};",
+			expect: `1:23: field designator "y" does not refer to any field in struct`,
+		},
+		{
+			title:  "array initialized by expression",
+			source: "int a[2] = 1;",
+			expect: "1:12: array initializer must be an initializer list",
+		},
+		{
+			title:  "array without size or initializer",
+			source: "int a[];",
+			expect: `1:5: variable "a" has incomplete type`,
+		},
+		{
+			title:  "assign to array",
+			source: "int a[3];a=1;",
+			expect: "1:11: array type is not assignable",
+		},
+		{
+			title:  "add pointers",
+			source: "int *p;int *q;p+q;",
+			expect: "1:16: invalid operands to binary + (pointer and pointer)",
+		},
+		{
+			title:  "wrong number of arguments",
+			source: "int f(int, long);f(1);",
+			expect: "1:19: function call expects 2 arguments but got 1",
+		},
+		{
+			title:  "static function",
+			source: "int f(int);static int f(int);",
+			expect: `1:23: static function "f" is not supported because functions cannot be defined`,
+		},
+		{
+			title:  "static function in block",
+			source: "{static int f(int);}",
+			expect: `1:13: static function "f" is not supported because functions cannot be defined`,
+		},
+		{
+			title:  "extern with different type",
+			source: "static int x;{extern long x;}",
+			expect: `1:27: conflicting types for "x"`,
+		},
+		{
+			title:  "extern without thread-local",
+			source: "_Thread_local int t;extern int t;",
+			expect: `1:32: thread-local and non-thread-local declarations of "t"`,
+		},
+		{
+			title:  "call non-function",
+			source: "int x;x(1);",
+			expect: "1:8: called object type int is not a function or function pointer",
+		},
+		{
+			title:  "conflicting function declarations",
+			source: "int f(int);long f(int);",
+			expect: `1:17: conflicting types for "f"`,
+		},
+		{
+			title:  "struct argument",
+			source: "struct s {int a;} x;int f(struct s);f(x);",
+			expect: "1:39: passing struct arguments is not supported",
+		},
+		{
+			title:  "missing close paren",
+			source: "int (*fp)(int);fp(1;",
+			expect: `1:20: expect "," but got ";"`,
+		},
+		{
+			title:  "function returning array",
+			source: "int (g(int))[3];",
+			expect: "1:7: function cannot return array type",
+		},
+		{
+			title:  "array of functions",
+			source: "int (a[3])(int);",
+			expect: "1:7: array has incomplete element type function",
+		},
+		{
+			title:  "cast to function type",
+			source: "(int (int))1;",
+			expect: "1:1: cannot cast to function type; scalar type is required",
+		},
+		{
+			title:  "array of incomplete arrays",
+			source: "int a[3][];",
+			expect: "1:6: array has incomplete element type array",
+		},
+		{
+			title:  "sizeof incomplete type",
+			source: "struct s *p;sizeof *p;",
+			expect: "1:13: invalid application of 'sizeof' to an incomplete type struct",
+		},
+		{
+			title:  "non-constant static initializer",
+			source: "static int x;int y;static int z = y;",
+			expect: "1:35: initializer element is not a compile-time constant",
+		},
+		{
+			title:  "extern with initializer",
+			source: "extern int x = 1;",
+			expect: `1:14: 'extern' variable "x" cannot have an initializer`,
+		},
+		{
+			title:  "multiple storage classes",
+			source: "static extern int x;",
+			expect: "1:8: multiple storage classes in declaration specifiers",
+		},
+		{
+			title:  "atomic array",
+			source: "typedef int A[2];_Atomic A a;",
+			expect: "1:18: '_Atomic' cannot be applied to array type",
+		},
+		{
+			title:  "atomic struct",
+			source: "_Atomic(struct {int a;}) s;",
+			expect: "1:1: '_Atomic' cannot be applied to struct type",
+		},
+		{
+			title:  "atomic bit-field",
+			source: "struct {_Atomic int a : 3;} s;",
+			expect: `1:21: bit-field "a" has atomic type`,
+		},
+		{
+			title:  "pointer to atomic discards qualifiers",
+			source: "_Atomic int x;int *p = &x;",
+			expect: "1:24: assignment to pointer to int from pointer to _Atomic int discards qualifiers",
+		},
+		{
+			title:  "atomic builtin with non-pointer argument",
+			source: "int x;__atomic_load_n(x, 0);",
+			expect: "1:7: argument 1 of '__atomic_load_n' must be a pointer type",
+		},
+		{
+			title:  "atomic fetch-add on pointer",
+			source: "int *p;atomic_fetch_add(&p, 1);",
+			expect: "1:8: argument 1 of 'atomic_fetch_add' must be a pointer to a non-boolean integer type",
+		},
+		{
+			title:  "atomic store to const",
+			source: "const int x = 0;atomic_store(&x, 1);",
+			expect: "1:17: argument 1 of 'atomic_store' must be a pointer to a non-const type",
+		},
+		{
+			title:  "atomic compare-exchange with mismatched expected",
+			source: "int x;long e;atomic_compare_exchange_strong(&x, &e, 1);",
+			expect: "1:14: argument 2 of 'atomic_compare_exchange_strong' must be a pointer to int",
+		},
+		{
+			title:  "atomic store with acquire",
+			source: "int x;__atomic_store_n(&x, 1, __ATOMIC_ACQUIRE);",
+			expect: "1:7: invalid memory model 2 for '__atomic_store_n'",
+		},
+		{
+			title:  "atomic load with release",
+			source: "int x;atomic_load_explicit(&x, memory_order_release);",
+			expect: "1:7: invalid memory model 3 for 'atomic_load_explicit'",
+		},
+		{
+			title:  "non-constant memory order",
+			source: "int x;int o = 5;__atomic_load_n(&x, o);",
+			expect: "1:17: memory order argument of '__atomic_load_n' is not an integer constant: node of kind \"GlobalVariable\" is not a constant expression",
+		},
+		{
+			title:  "unknown escape sequence in asm",
+			source: `asm("\q");`,
+			expect: `1:5: unknown escape sequence '\q'`,
+		},
+		{
+			title:  "asm output without '='",
+			source: `int x;asm("" : "r"(x));`,
+			expect: "1:7: output operand constraint lacks '='",
+		},
+		{
+			title:  "asm output to rvalue",
+			source: `int x;asm("" : "=r"(x + 1));`,
+			expect: "1:7: invalid lvalue in asm output 0",
+		},
+		{
+			title:  "asm output to const",
+			source: `const int x = 0;asm("" : "=r"(x));`,
+			expect: "1:17: cannot assign to asm output 0 with const-qualified type const int",
+		},
+		{
+			title:  "asm operand of struct type",
+			source: `struct {long a;} s;asm("" : : "r"(s));`,
+			expect: "1:20: asm operand 0 of type struct cannot be held in a register",
+		},
+		{
+			title:  "asm memory input not addressable",
+			source: `asm("" : : "m"(1));`,
+			expect: "1:1: memory input 0 is not directly addressable",
+		},
+		{
+			title:  "unsupported asm constraint",
+			source: `int x;asm("" : "=x"(x));`,
+			expect: `1:7: unsupported constraint "=x" in asm operand 0`,
+		},
+		{
+			title:  "asm operand conflicts with clobber",
+			source: `asm("" : : "a"(1) : "eax");`,
+			expect: "1:1: asm operand 0 conflicts with clobbered register rax",
+		},
+		{
+			title:  "asm outputs in the same register",
+			source: `int x;int y;asm("" : "=a"(x), "=a"(y));`,
+			expect: "1:13: asm operand 1 uses register rax that is already in use",
+		},
+		{
+			title:  "invalid matching constraint",
+			source: `int x;asm("" : "=m"(x) : "0"(1));`,
+			expect: "1:7: matching constraint references invalid operand number 0",
+		},
+		{
+			title:  "unknown clobber",
+			source: `asm("" : : : "rsp");`,
+			expect: `1:14: unknown register name "rsp" in 'asm'`,
+		},
+		{
+			title:  "asm operand number out of range",
+			source: `int x;asm("mov %1, 0" : "=r"(x));`,
+			expect: "1:7: invalid 'asm': operand number out of range: 1",
+		},
+		{
+			title:  "undefined asm operand name",
+			source: `int x;asm("mov %[y], 0" : [x] "=r"(x));`,
+			expect: `1:7: invalid 'asm': undefined named operand "y"`,
+		},
+		{
+			title:  "too many asm operands",
+			source: `asm("" : : "r"(1), "r"(2), "r"(3), "r"(4), "r"(5), "r"(6), "r"(7), "r"(8), "r"(9), "r"(10));`,
+			expect: "1:1: 'asm' operand has impossible constraints",
+		},
+		{
+			title:  "global variable named main",
+			source: "int main;",
+			expect: `1:5: "main" redeclared as different kind of symbol`,
+		},
+		{
+			title:  "thread-local variable at block scope",
+			source: "{_Thread_local int x;}",
+			expect: `1:20: function-scope "x" implicitly auto and declared '_Thread_local'`,
+		},
+		{
+			title:  "duplicate thread-local specifier",
+			source: "static __thread _Thread_local int x;",
+			expect: "1:17: duplicate '_Thread_local'",
+		},
+		{
+			title:  "thread-local typedef",
+			source: "__thread typedef int T;",
+			expect: "1:10: '__thread' used with 'typedef'",
+		},
+		{
+			title:  "cast double to pointer",
+			source: "double d;(int*)d;",
+			expect: "1:10: cannot cast from double type to pointer type",
+		},
+		{
+			title:  "assign float to pointer",
+			source: "int *p;p=1.0f;",
+			expect: "1:9: incompatible types in assignment to pointer from float",
+		},
+		{
+			title:  "switch on double",
+			source: "switch(1.0){}",
+			expect: "1:1: statement requires expression of integer type (double invalid)",
+		},
+		{
+			title:  "float case label",
+			source: "switch(1){case 1.5:1;}",
+			expect: "1:11: case label is not an integer constant",
+		},
+		{
+			title:  "assign to const variable",
+			source: "const int x = 1;x=2;",
+			expect: "1:18: cannot assign to lvalue with const-qualified type const int",
+		},
+		{
+			title:  "assign through pointer to const",
+			source: "int x;const int *p = &x;*p=2;",
+			expect: "1:27: cannot assign to lvalue with const-qualified type const int",
+		},
+		{
+			title:  "assign to const pointer",
+			source: "int x;int *const p = &x;p=0;",
+			expect: "1:26: cannot assign to lvalue with const-qualified type const pointer",
+		},
+		{
+			title:  "assign to member of const struct",
+			source: "const struct {int a;} s = {1};s.a=2;",
+			expect: "1:34: cannot assign to lvalue with const-qualified type const int",
+		},
+		{
+			title:  "assign to struct with const member",
+			source: "struct S {const int a;} s, t;s=t;",
+			expect: "1:31: cannot assign to struct with const-qualified member",
+		},
+		{
+			title:  "discard const in assignment",
+			source: "const int x = 1;int *p;p=&x;",
+			expect: "1:25: assignment to pointer to int from pointer to const int discards qualifiers",
+		},
+		{
+			title:  "discard const in initializer",
+			source: "const int a[2] = {1, 2};int *p = a;",
+			expect: "1:34: assignment to pointer to int from pointer to const int discards qualifiers",
+		},
+		{
+			title:  "discard volatile in initializer",
+			source: "volatile long x;long *p = &x;",
+			expect: "1:27: assignment to pointer to long from pointer to volatile long discards qualifiers",
+		},
+		{
+			title:  "add statement expression ending with declaration",
+			source: "1+({ 2; int x; });",
+			expect: "1:2: invalid operands to binary + (int and void)",
+		},
+		{
+			title:  "assign empty statement expression",
+			source: "x = ({});",
+			expect: "1:5: value of statement expression is used but it does not end with an expression statement",
+		},
+		{
+			title:  "return statement expression ending with return",
+			source: "return ({ return 1; });",
+			expect: "1:8: value of statement expression is used but it does not end with an expression statement",
+		},
+		{
+			title:  "compound literal of incomplete struct",
+			source: "struct s;(struct s){1};",
+			expect: "1:10: compound literal has incomplete type struct",
+		},
+		{
+			title:  "excess elements in compound literal",
+			source: "(int[2]){1, 2, 3};",
+			expect: "excess elements in array initializer",
+		},
+		{
+			title:  "address of bit-field",
+			source: "struct {int a:3;} s;&s.a;",
+			expect: "1:21: address of bit-field requested",
+		},
+		{
+			title:  "sizeof bit-field",
+			source: "struct {int a:3;} s;sizeof s.a;",
+			expect: "1:21: invalid application of 'sizeof' to bit-field",
+		},
+		{
+			title:  "bit-field exceeds its type",
+			source: "struct {short a:17;} s;",
+			expect: `1:15: width of bit-field "a" (17 bits) exceeds the width of its type (16 bits)`,
+		},
+		{
+			title:  "bool bit-field wider than 1",
+			source: "struct {_Bool b:2;} s;",
+			expect: `1:15: width of bit-field "b" (2 bits) exceeds the width of its type (1 bits)`,
+		},
+		{
+			title:  "named bit-field with zero width",
+			source: "struct {int a:0;} s;",
+			expect: `1:13: named bit-field "a" has zero width`,
+		},
+		{
+			title:  "negative bit-field width",
+			source: "struct {int :-1;} s;",
+			expect: `1:13: bit-field "(anonymous)" has negative width (-1)`,
+		},
+		{
+			title:  "bit-field of pointer type",
+			source: "struct {int *p:3;} s;",
+			expect: `1:14: bit-field "p" has non-integral type pointer`,
+		},
+		{
+			title:  "static assertion failed",
+			source: "int x;_Static_assert(sizeof(x) == 8, \"x must be 8 bytes\");",
+			expect: `1:7: static assertion failed: "x must be 8 bytes"`,
+		},
+		{
+			title:  "static assertion failed without message",
+			source: "{_Static_assert(0);}",
+			expect: "1:2: static assertion failed",
+		},
+		{
+			title:  "static assertion in struct failed",
+			source: "struct {int a;_Static_assert(sizeof(int) < 4, \"small\");} s;",
+			expect: `1:15: static assertion failed: "small"`,
+		},
+		{
+			title:  "static assertion of non-constant",
+			source: "int x;_Static_assert(x, \"x\");",
+			expect: "1:22: static assertion expression is not an integer constant expression",
+		},
+		{
+			title:  "alignment not a power of 2",
+			source: "_Alignas(3) int x;",
+			expect: "1:1: requested alignment 3 is not a positive power of 2",
+		},
+		{
+			title:  "alignment less than the type",
+			source: "_Alignas(2) int x;",
+			expect: `1:17: requested alignment 2 is less than minimum alignment 4 of "x"`,
+		},
+		{
+			title:  "local alignment exceeds the stack alignment",
+			source: "{_Alignas(32) int x;}",
+			expect: `1:19: alignment 32 of local variable "x" exceeds the stack alignment 16`,
+		},
+		{
+			title:  "alignas in typedef",
+			source: "typedef _Alignas(8) int T;",
+			expect: "1:9: '_Alignas' attribute cannot be applied to a typedef",
+		},
+		{
+			title:  "alignas in type name",
+			source: "(_Alignas(8) int)1;",
+			expect: "1:2: '_Alignas' attribute cannot be applied to a type name or parameter",
+		},
+		{
+			title:  "alignof incomplete type",
+			source: "struct s;_Alignof(struct s);",
+			expect: "1:10: invalid application of '_Alignof' to an incomplete type struct",
+		},
+		{
+			title:  "no matching generic association",
+			source: "_Generic(1.0, int: 1, long: 2);",
+			expect: "1:1: controlling expression type double not compatible with any generic association type",
+		},
+		{
+			title:  "compatible generic associations",
+			source: "_Generic(1, int: 1, signed int: 2);",
+			expect: "1:21: type int in generic association compatible with previously specified type",
+		},
+		{
+			title:  "duplicate default generic association",
+			source: "_Generic(1, default: 1, default: 2);",
+			expect: "1:25: duplicate default generic association",
+		},
+		{
+			title:  "generic without association",
+			source: "_Generic(1);",
+			expect: "1:1: expected generic association",
+		},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.title, func(t *testing.T) {
+			p, err := ast.NewTParser(tt.source)
+			if err != nil {
+				t.Errorf("[%q, %q] expect error to be nil but got:\n %+v while creating parser", tt.title, tt.source, err)
+			}
+			_, err = p.Program()
+			if err == nil {
+				t.Fatalf("[%q, %q] expect error to be not nil but got nil", tt.title, tt.source)
+			}
+			if !strings.Contains(err.Error(), tt.expect) {
+				t.Errorf("[%q, %q] expect error to contain %q but got %q", tt.title, tt.source, tt.expect, err.Error())
+			}
+		})
+	}
+}
+
+func TestTParser_StructLayout(t *testing.T) {
+	type member struct {
+		Name   string
+		Offset int
+	}
+	testcases := [...]struct {
+		title   string
+		source  string
+		size    int
+		align   int
+		members []member
+	}{
+		{
+			title:   "scalar members",
+			source:  "struct {int a;int *b;int c;} s;s;",
+			size:    24,
+			align:   8,
+			members: []member{{"a", 0}, {"b", 8}, {"c", 16}},
+		},
+		{
+			title:   "nested struct",
+			source:  "struct {int a;struct {int b;int c;} in;int d;} s;s;",
+			size:    16,
+			align:   4,
+			members: []member{{"a", 0}, {"in", 4}, {"d", 12}},
+		},
+		{
+			title:   "padding between members of different sizes",
+			source:  "struct {short a;int b;short c;long d;short e;} s;s;",
+			size:    32,
+			align:   8,
+			members: []member{{"a", 0}, {"b", 4}, {"c", 8}, {"d", 16}, {"e", 24}},
+		},
+		{
+			title:   "struct of shorts",
+			source:  "struct {short a;unsigned short b;short c;} s;s;",
+			size:    6,
+			align:   2,
+			members: []member{{"a", 0}, {"b", 2}, {"c", 4}},
+		},
+		{
+			title:   "self-referential struct",
+			source:  "struct node {int v;struct node *next;} n;n;",
+			size:    16,
+			align:   8,
+			members: []member{{"v", 0}, {"next", 8}},
+		},
+		{
+			title:   "union",
+			source:  "union {int a;struct {int b;int c;} s;int *p;} u;u;",
+			size:    8,
+			align:   8,
+			members: []member{{"a", 0}, {"s", 0}, {"p", 0}},
+		},
+		{
+			title:   "array member",
+			source:  "struct {short a;int b[3];short c;} s;s;",
+			size:    20,
+			align:   4,
+			members: []member{{"a", 0}, {"b", 4}, {"c", 16}},
+		},
+		{
+			title:  "empty struct",
+			source: "struct {} s;s;",
+			size:   0,
+			align:  1,
+		},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.title, func(t *testing.T) {
+			p, err := ast.NewTParser(tt.source)
+			if err != nil {
+				t.Fatalf("[%q, %q] expect error to be nil but got:\n %+v while creating parser", tt.title, tt.source, err)
+			}
+			nodes, err := p.Program()
+			if err != nil {
+				t.Fatalf("[%q, %q] expect error to be nil but got:\n %+v", tt.title, tt.source, err)
+			}
+			ty := nodes[len(nodes)-1].Type
+			if ty.Size != tt.size || ty.Align != tt.align {
+				t.Errorf("[%q] expect size = %d, align = %d but got size = %d, align = %d", tt.title, tt.size, tt.align, ty.Size, ty.Align)
+			}
+			var got []member
+			for _, m := range ty.Members {
+				got = append(got, member{m.Name, m.Offset})
+			}
+			if diff := cmp.Diff(got, tt.members); diff != "" {
+				t.Errorf("[%q] members differ: (-got +expect)\n%s", tt.title, diff)
+			}
+		})
+	}
+}
+
+func TestTParser_BitfieldLayout(t *testing.T) {
+	type member struct {
+		Name      string
+		Offset    int
+		BitOffset int
+		BitWidth  int
+	}
+	testcases := [...]struct {
+		title   string
+		source  string
+		size    int
+		align   int
+		members []member
+	}{
+		{
+			title:   "packed into one unit",
+			source:  "struct {unsigned a:3;unsigned b:5;int c:20;} s;s;",
+			size:    4,
+			align:   4,
+			members: []member{{"a", 0, 0, 3}, {"b", 0, 3, 5}, {"c", 0, 8, 20}},
+		},
+		{
+			title:   "bit-field after ordinary member",
+			source:  "struct {short a;int b:16;} s;s;",
+			size:    4,
+			align:   4,
+			members: []member{{"a", 0, 0, 0}, {"b", 0, 16, 16}},
+		},
+		{
+			title:   "bit-field does not straddle its unit",
+			source:  "struct {short a;int b:20;} s;s;",
+			size:    8,
+			align:   4,
+			members: []member{{"a", 0, 0, 0}, {"b", 4, 0, 20}},
+		},
+		{
+			title:   "units of different types",
+			source:  "struct {long a:40;int b:20;int c:30;} s;s;",
+			size:    16,
+			align:   8,
+			members: []member{{"a", 0, 0, 40}, {"b", 4, 8, 20}, {"c", 8, 0, 30}},
+		},
+		{
+			title:   "zero width bit-field",
+			source:  "struct {_Bool a;int :0;_Bool b;} s;s;",
+			size:    5,
+			align:   1,
+			members: []member{{"a", 0, 0, 0}, {"b", 4, 0, 0}},
+		},
+		{
+			title:   "unnamed bit-field",
+			source:  "struct {int a:4;int :4;int b:4;} s;s;",
+			size:    4,
+			align:   4,
+			members: []member{{"a", 0, 0, 4}, {"b", 0, 8, 4}},
+		},
+		{
+			title:   "union",
+			source:  "union {long a:3;short b:12;} u;u;",
+			size:    8,
+			align:   8,
+			members: []member{{"a", 0, 0, 3}, {"b", 0, 0, 12}},
+		},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.title, func(t *testing.T) {
+			p, err := ast.NewTParser(tt.source)
+			if err != nil {
+				t.Fatalf("[%q, %q] expect error to be nil but got:\n %+v while creating parser", tt.title, tt.source, err)
+			}
+			nodes, err := p.Program()
+			if err != nil {
+				t.Fatalf("[%q, %q] expect error to be nil but got:\n %+v", tt.title, tt.source, err)
+			}
+			ty := nodes[len(nodes)-1].Type
+			if ty.Size != tt.size || ty.Align != tt.align {
+				t.Errorf("[%q] expect size = %d, align = %d but got size = %d, align = %d", tt.title, tt.size, tt.align, ty.Size, ty.Align)
+			}
+			var got []member
+			for _, m := range ty.Members {
+				got = append(got, member{m.Name, m.Offset, m.BitOffset, m.BitWidth})
+			}
+			if diff := cmp.Diff(got, tt.members); diff != "" {
+				t.Errorf("[%q] members differ: (-got +expect)\n%s", tt.title, diff)
+			}
+		})
+	}
+}
+
+func TestTParser_Globals(t *testing.T) {
+	testcases := [...]struct {
+		title  string
+		source string
+		expect []*ast.GVar
+	}{
+		{
+			title:  "uninitialized",
+			source: "static long a;",
+			expect: []*ast.GVar{{Label: ".L.static.a.1", Type: ast.LongType}},
+		},
+		{
+			title:  "array of shorts",
+			source: "static short a[] = {1, -1, 256};",
+			expect: []*ast.GVar{{Label: ".L.static.a.1", Type: ast.ArrayOf(ast.ShortType, 3), Init: []byte{1, 0, 255, 255, 0, 1}}},
+		},
+		{
+			title:  "struct with padding",
+			source: "static struct {short s;int i;} x = {2, .i = 3};",
+			expect: []*ast.GVar{{
+				Label: ".L.static.x.1",
+				Type: &ast.Type{
+					Kind:  ast.TyStruct,
+					Size:  8,
+					Align: 4,
+					Members: []*ast.Member{
+						{Name: "s", Type: ast.ShortType, Offset: 0},
+						{Name: "i", Type: ast.IntType, Offset: 4},
+					},
+				},
+				Init: []byte{2, 0, 0, 0, 3, 0, 0, 0},
+			}},
+		},
+		{
+			title:  "float",
+			source: "static float f = -1;",
+			expect: []*ast.GVar{{Label: ".L.static.f.1", Type: ast.FloatType, Init: []byte{0, 0, 0x80, 0xbf}}},
+		},
+		{
+			title:  "extern",
+			source: "extern int a[];",
+			expect: []*ast.GVar{{Label: "a", Type: ast.ArrayOf(ast.IntType, -1), Extern: true}},
+		},
+		{
+			title:  "thread-local",
+			source: "static _Thread_local int a = 1;extern __thread long b;",
+			expect: []*ast.GVar{
+				{Label: ".L.static.a.1", Type: ast.IntType, Init: []byte{1, 0, 0, 0}, ThreadLocal: true},
+				{Label: "b", Type: ast.LongType, Extern: true, ThreadLocal: true},
+			},
+		},
+		{
+			title:  "global",
+			source: "int x = 3;long y;{int z = 4;}",
+			expect: []*ast.GVar{
+				{Label: ".L.global.x.1", Name: "x", Type: ast.IntType, Init: []byte{3, 0, 0, 0}},
+				{Label: ".L.global.y.2", Name: "y", Type: ast.LongType},
+			},
+		},
+		{
+			title:  "global with non-constant initializer",
+			source: "int a = 1;int b = a;",
+			expect: []*ast.GVar{
+				{Label: ".L.global.a.1", Name: "a", Type: ast.IntType, Init: []byte{1, 0, 0, 0}},
+				{Label: ".L.global.b.2", Name: "b", Type: ast.IntType},
+			},
+		},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.title, func(t *testing.T) {
+			p, err := ast.NewTParser(tt.source)
+			if err != nil {
+				t.Fatalf("[%q] expect error to be nil but got:\n %+v while creating parser", tt.source, err)
+			}
+			if _, err := p.Program(); err != nil {
+				t.Fatalf("[%q] expect error to be nil but got:\n %+v", tt.source, err)
+			}
+			if diff := cmp.Diff(p.Globals(), tt.expect); diff != "" {
+				t.Errorf("input: %s\ndiffers: (-got +expect)\n%s\n", tt.source, diff)
+			}
+		})
+	}
+}
+
+func TestTParser_AsmOperands(t *testing.T) {
+	testcases := [...]struct {
+		title  string
+		source string
+		expect []string // オペランドに割り当てられたレジスタ
+	}{
+		{
+			title:  "specific registers",
+			source: `unsigned lo;unsigned hi;asm("rdtsc" : "=a"(lo), "=d"(hi));`,
+			expect: []string{"rax", "rdx"},
+		},
+		{
+			title:  "general registers avoid specific registers and clobbers",
+			source: `long x;asm("" : "=r"(x) : "a"(1), "r"(2) : "rcx");`,
+			expect: []string{"rdx", "rax", "rsi"},
+		},
+		{
+			title:  "input shares register with output",
+			source: `long ret;asm("syscall" : "=a"(ret) : "a"(39) : "rcx", "r11");`,
+			expect: []string{"rax", "rax"},
+		},
+		{
+			title:  "matching constraint",
+			source: `long x;asm("" : "=r"(x) : "0"(1));`,
+			expect: []string{"rax", "rax"},
+		},
+		{
+			title:  "memory operand holds address in register",
+			source: `int x;asm("" : "+m"(x) : "D"(1));`,
+			expect: []string{"rax", "rdi"},
+		},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.title, func(t *testing.T) {
+			p, err := ast.NewTParser(tt.source)
+			if err != nil {
+				t.Fatalf("[%q] expect error to be nil but got:\n %+v while creating parser", tt.source, err)
+			}
+			nodes, err := p.Program()
+			if err != nil {
+				t.Fatalf("[%q] expect error to be nil but got:\n %+v", tt.source, err)
+			}
+			var got []string
+			for _, op := range nodes[len(nodes)-1].Asm.Operands() {
+				got = append(got, op.Reg)
+			}
+			if diff := cmp.Diff(got, tt.expect); diff != "" {
+				t.Errorf("input: %s\ndiffers: (-got +expect)\n%s\n", tt.source, diff)
+			}
+		})
+	}
+}
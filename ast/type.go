@@ -0,0 +1,491 @@
+package ast
+
+import "math"
+
+// TypeKind represents kind of a type
+type TypeKind string
+
+const (
+	TyBool     TypeKind = "_Bool"
+	TyShort    TypeKind = "short"
+	TyInt      TypeKind = "int"
+	TyLong     TypeKind = "long"
+	TyLongLong TypeKind = "long long"
+	TyPtr      TypeKind = "pointer"
+	TyStruct   TypeKind = "struct"
+	TyUnion    TypeKind = "union"
+	TyEnum     TypeKind = "enum"
+	TyFloat    TypeKind = "float"
+	TyDouble   TypeKind = "double"
+	TyArray    TypeKind = "array"
+	TyFunc     TypeKind = "function"
+	TyVoid     TypeKind = "void" // 値を持たない式の型. 最後の文が式文でない文式だけがこの型になる
+)
+
+// Type represents a type of a value
+type Type struct {
+	Kind     TypeKind
+	Size     int       // sizeofの値。不完全型の場合は-1
+	Align    int       // アラインメント
+	Unsigned bool      // 符号なし整数型であるときtrue
+	Base     *Type     // 指す先の型、または要素の型. only used when Kind = TyPtr, TyArray
+	Members  []*Member // only used when Kind = TyStruct, TyUnion
+	ArrayLen int       // 要素数。省略された場合は-1. only used when Kind = TyArray
+	Return   *Type     // 戻り値の型. only used when Kind = TyFunc
+	Params   []*Type   // 引数の型. 空の場合は引数の情報がない. only used when Kind = TyFunc
+	Const    bool      // const修飾されているときtrue
+	Volatile bool      // volatile修飾されているときtrue
+	Atomic   bool      // _Atomic修飾されているときtrue
+	Origin   *Type     // 修飾子とアラインメント指定を取り除いた型. 修飾された型とアラインメントを指定された型の場合のみ設定する
+}
+
+// Member represents a member of a struct or union
+type Member struct {
+	Name       string
+	Type       *Type
+	Offset     int  // 構造体の先頭からのオフセット. ビットフィールドの場合は、値を含む型Typeの大きさの格納単位のオフセット
+	IsBitfield bool // ビットフィールドであるときtrue
+	BitOffset  int  // 格納単位の最下位ビットから数えたビットフィールドの位置. only used when IsBitfield = true
+	BitWidth   int  // ビットフィールドの幅. only used when IsBitfield = true
+}
+
+// 整数型
+var (
+	BoolType      = &Type{Kind: TyBool, Size: 1, Align: 1, Unsigned: true} // 0か1の値だけを取る
+	ShortType     = &Type{Kind: TyShort, Size: 2, Align: 2}
+	IntType       = &Type{Kind: TyInt, Size: 4, Align: 4}
+	LongType      = &Type{Kind: TyLong, Size: 8, Align: 8} // 未宣言の変数はこの型になる
+	LongLongType  = &Type{Kind: TyLongLong, Size: 8, Align: 8}
+	UShortType    = &Type{Kind: TyShort, Size: 2, Align: 2, Unsigned: true}
+	UIntType      = &Type{Kind: TyInt, Size: 4, Align: 4, Unsigned: true}
+	ULongType     = &Type{Kind: TyLong, Size: 8, Align: 8, Unsigned: true}
+	ULongLongType = &Type{Kind: TyLongLong, Size: 8, Align: 8, Unsigned: true}
+)
+
+// 浮動小数点数型
+var (
+	FloatType  = &Type{Kind: TyFloat, Size: 4, Align: 4}
+	DoubleType = &Type{Kind: TyDouble, Size: 8, Align: 8}
+)
+
+// VoidType は、値を持たない式の型
+var VoidType = &Type{Kind: TyVoid, Size: -1, Align: 1}
+
+// PointerTo は、baseを指すポインタ型を返す
+func PointerTo(base *Type) *Type {
+	return &Type{Kind: TyPtr, Size: 8, Align: 8, Base: base}
+}
+
+// ArrayOf は、要素の型がbaseで要素数がnの配列型を返す。nが負の場合は要素数を省略した不完全型になる
+func ArrayOf(base *Type, n int) *Type {
+	if n < 0 {
+		return &Type{Kind: TyArray, Size: -1, Align: base.Align, Base: base, ArrayLen: -1}
+	}
+	return &Type{Kind: TyArray, Size: base.Size * n, Align: base.Align, Base: base, ArrayLen: n}
+}
+
+// FuncType は、戻り値の型がret、引数の型がparamsの関数型を返す。関数型はサイズを持たない
+func FuncType(ret *Type, params []*Type) *Type {
+	return &Type{Kind: TyFunc, Size: -1, Align: 1, Return: ret, Params: params}
+}
+
+// 型修飾子の集まり
+type qualifiers struct {
+	isConst    bool
+	isVolatile bool
+	isAtomic   bool
+}
+
+// qualify は、tyに修飾子qを加えた型を返す。修飾子がなければtyをそのまま返す。
+// 修飾された型はtyのコピーで、Originから修飾されていない型をたどれる
+func qualify(ty *Type, q qualifiers) *Type {
+	if !q.isConst && !q.isVolatile && !q.isAtomic {
+		return ty
+	}
+	qualified := *ty
+	qualified.Const = ty.Const || q.isConst
+	qualified.Volatile = ty.Volatile || q.isVolatile
+	qualified.Atomic = ty.Atomic || q.isAtomic
+	qualified.Origin = ty.Unqualified()
+	return &qualified
+}
+
+// alignedTo は、アラインメントをalignに引き上げたtyのコピーを返す。alignはty.Align以上でなければならない
+func alignedTo(ty *Type, align int) *Type {
+	if align == ty.Align {
+		return ty
+	}
+	aligned := *ty
+	aligned.Align = align
+	aligned.Origin = ty.Unqualified()
+	return &aligned
+}
+
+// Unqualified は、tyから修飾子を取り除いた型を返す
+func (ty *Type) Unqualified() *Type {
+	if ty.Origin != nil {
+		return ty.Origin
+	}
+	return ty
+}
+
+// qualifiersOf は、tyに付いている修飾子を返す
+func qualifiersOf(ty *Type) qualifiers {
+	return qualifiers{isConst: ty.Const, isVolatile: ty.Volatile, isAtomic: ty.Atomic}
+}
+
+// qualifiedName は、エラー表示のために修飾子を付けた型の名前を返す
+func qualifiedName(ty *Type) string {
+	name := string(ty.Kind)
+	if ty.Volatile {
+		name = "volatile " + name
+	}
+	if ty.Atomic {
+		name = "_Atomic " + name
+	}
+	if ty.Const {
+		name = "const " + name
+	}
+	return name
+}
+
+// IsInteger は、tyが整数型(列挙型を含む)であるときtrueを返す
+func (ty *Type) IsInteger() bool {
+	switch ty.Kind {
+	case TyBool, TyShort, TyInt, TyLong, TyLongLong, TyEnum:
+		return true
+	}
+	return false
+}
+
+// IsFlonum は、tyが浮動小数点数型であるときtrueを返す
+func (ty *Type) IsFlonum() bool {
+	return ty.Kind == TyFloat || ty.Kind == TyDouble
+}
+
+// IsArithmetic は、tyが整数型または浮動小数点数型であるときtrueを返す
+func (ty *Type) IsArithmetic() bool {
+	return ty.IsInteger() || ty.IsFlonum()
+}
+
+// IsAggregate は、tyが構造体型または共用体型であるときtrueを返す。
+// これらの型の値は、値そのものではなくメモリアドレスで扱う
+func (ty *Type) IsAggregate() bool {
+	return ty.Kind == TyStruct || ty.Kind == TyUnion
+}
+
+// hasBase は、tyがポインタ型または配列型であるときtrueを返す。
+// 配列型の値は式の中で先頭要素を指すポインタとして扱う
+func (ty *Type) hasBase() bool {
+	return ty.Kind == TyPtr || ty.Kind == TyArray
+}
+
+// IsComplete は、tyのサイズが確定している場合にtrueを返す
+func (ty *Type) IsComplete() bool {
+	return ty.Size >= 0
+}
+
+// findMember は、構造体型または共用体型tyのnameという名前のメンバーを返す。存在しなければnilを返す。
+func (ty *Type) findMember(name string) *Member {
+	for _, m := range ty.Unqualified().Members {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// setStructLayout は、メンバーの型からオフセットとパディングを計算し、構造体型tyのメンバーとサイズを確定する。
+// ビットフィールドはgccと同じく、型の大きさに揃えた格納単位をまたがない限り直前のメンバーに詰めて配置する。
+// 名前のないビットフィールドは配置だけに影響し、メンバーにもアラインメントにも含めない
+func (ty *Type) setStructLayout(members []*Member) {
+	bits, align := 0, 1
+	var named []*Member
+	for _, m := range members {
+		if !m.IsBitfield {
+			bits = alignTo(bits, m.Type.Align*8)
+			m.Offset = bits / 8
+			bits += m.Type.Size * 8
+		} else {
+			unit := m.Type.Size * 8
+			if m.BitWidth == 0 || bits/unit != (bits+m.BitWidth-1)/unit { // 幅0のビットフィールドは次の格納単位から配置させる
+				bits = alignTo(bits, unit)
+			}
+			m.Offset = bits / unit * m.Type.Size
+			m.BitOffset = bits % unit
+			bits += m.BitWidth
+		}
+		if m.Name == "" {
+			continue
+		}
+		named = append(named, m)
+		if align < m.Type.Align {
+			align = m.Type.Align
+		}
+	}
+	ty.Members = named
+	ty.Align = align
+	ty.Size = alignTo(alignTo(bits, 8)/8, align) // 配列にしたときに次の要素のアラインメントが崩れないよう末尾にパディングを入れる
+}
+
+// setUnionLayout は、全てのメンバーをオフセット0に配置し、共用体型tyのメンバーとサイズを確定する
+func (ty *Type) setUnionLayout(members []*Member) {
+	size, align := 0, 1
+	var named []*Member
+	for _, m := range members {
+		msize := m.Type.Size
+		if m.IsBitfield {
+			msize = alignTo(m.BitWidth, 8) / 8
+		}
+		if size < msize {
+			size = msize
+		}
+		if m.Name == "" {
+			continue
+		}
+		named = append(named, m)
+		if align < m.Type.Align {
+			align = m.Type.Align
+		}
+	}
+	ty.Members = named
+	ty.Align = align
+	ty.Size = alignTo(size, align)
+}
+
+// nをalignの倍数に切り上げる
+func alignTo(n, align int) int {
+	return (n + align - 1) / align * align
+}
+
+// isCompatible は、型t1とt2が互換であるときtrueを返す。
+// 修飾子の異なる型は互換でない。構造体・共用体・列挙型は同じ宣言による型とだけ互換になる。
+// 関数型の引数の型は、最上位の修飾子を取り除いて比べる
+func isCompatible(t1, t2 *Type) bool {
+	if qualifiersOf(t1) != qualifiersOf(t2) {
+		return false
+	}
+	t1, t2 = t1.Unqualified(), t2.Unqualified()
+	if t1 == t2 {
+		return true
+	}
+	if t1.Kind != t2.Kind {
+		return false
+	}
+	switch t1.Kind {
+	case TyPtr:
+		return isCompatible(t1.Base, t2.Base)
+	case TyArray:
+		return isCompatible(t1.Base, t2.Base) && (t1.ArrayLen < 0 || t2.ArrayLen < 0 || t1.ArrayLen == t2.ArrayLen)
+	case TyFunc:
+		if !isCompatible(t1.Return, t2.Return) || len(t1.Params) != len(t2.Params) {
+			return false
+		}
+		for i := range t1.Params {
+			if !isCompatible(t1.Params[i].Unqualified(), t2.Params[i].Unqualified()) {
+				return false
+			}
+		}
+		return true
+	case TyStruct, TyUnion, TyEnum:
+		return false
+	}
+	return t1.Unsigned == t2.Unsigned
+}
+
+// lvalueConverted は、型tyの式の値を取り出したときの型を返す。
+// 修飾子は取り除かれ、配列は先頭要素へのポインタ、関数は関数へのポインタになる
+func lvalueConverted(ty *Type) *Type {
+	switch ty.Kind {
+	case TyArray:
+		return PointerTo(ty.Base)
+	case TyFunc:
+		return PointerTo(ty)
+	}
+	return ty.Unqualified()
+}
+
+// calleeType は、型tyの値を呼び出すときの関数型を返す。tyが関数型でも関数へのポインタ型でもなければnilを返す
+func calleeType(ty *Type) *Type {
+	ty = ty.Unqualified()
+	if ty.Kind == TyPtr {
+		ty = ty.Base.Unqualified()
+	}
+	if ty.Kind != TyFunc {
+		return nil
+	}
+	return ty
+}
+
+// 整数型の変換の順位. 列挙型はintとして扱う
+var integerRank = map[TypeKind]int{
+	TyBool:     0,
+	TyShort:    1,
+	TyInt:      2,
+	TyEnum:     2,
+	TyLong:     3,
+	TyLongLong: 4,
+}
+
+// integerPromotion は、整数型tyに整数拡張を適用した型を返す。
+// intより順位の低い型はintに変換される(intは_Boolと符号なしshortの全ての値を表せる)
+func integerPromotion(ty *Type) *Type {
+	ty = ty.Unqualified()
+	if integerRank[ty.Kind] <= integerRank[TyInt] {
+		if ty.Kind == TyInt {
+			return ty
+		}
+		return IntType
+	}
+	return ty
+}
+
+// usualArithmeticConversion は、算術型t1, t2に通常の算術型変換を適用した共通の型を返す
+func usualArithmeticConversion(t1, t2 *Type) *Type {
+	t1, t2 = t1.Unqualified(), t2.Unqualified()
+	if t1.Kind == TyDouble || t2.Kind == TyDouble {
+		return DoubleType
+	}
+	if t1.Kind == TyFloat || t2.Kind == TyFloat {
+		return FloatType
+	}
+	t1, t2 = integerPromotion(t1), integerPromotion(t2)
+	if t1 == t2 {
+		return t1
+	}
+	r1, r2 := integerRank[t1.Kind], integerRank[t2.Kind]
+	if t1.Unsigned == t2.Unsigned {
+		if r1 >= r2 {
+			return t1
+		}
+		return t2
+	}
+	if t2.Unsigned { // t1を符号なしの型にそろえる
+		t1, t2 = t2, t1
+		r1, r2 = r2, r1
+	}
+	if r1 >= r2 {
+		return t1 // 符号なしの型の順位が符号付きの型以上であれば符号なしの型になる
+	}
+	if t2.Size > t1.Size {
+		return t2 // 符号付きの型が符号なしの型の全ての値を表せるなら符号付きの型になる
+	}
+	return unsignedOf(t2)
+}
+
+// unsignedOf は、符号付き整数型tyに対応する符号なし整数型を返す
+func unsignedOf(ty *Type) *Type {
+	switch ty.Kind {
+	case TyLong:
+		return ULongType
+	case TyLongLong:
+		return ULongLongType
+	}
+	return UIntType
+}
+
+// newCast は、nodeの値を型tyに変換するNodeを返す。変換が不要な場合はnodeをそのまま返す
+func newCast(node *Node, ty *Type) *Node {
+	if node.Type == ty {
+		return node
+	}
+	return &Node{Kind: Cast, Lhs: node, Type: ty}
+}
+
+// assignCast は、型tyのオブジェクトに代入するnodeの値を、その型に変換するNodeを返す。
+// _Boolへの代入では、ポインタも含め全てのスカラーの値を0か1に変換する
+func assignCast(node *Node, ty *Type) *Node {
+	ty = ty.Unqualified()
+	if ty.Kind == TyBool && !node.Type.IsAggregate() || ty.IsArithmetic() && node.Type.IsArithmetic() {
+		return newCast(node, ty)
+	}
+	return node
+}
+
+// AddType は、nodeとその子孫のNodeのうち型が設定されていないものに型を設定する。
+// 算術型の演算と代入には、通常の算術型変換に従って型変換のNodeを挿入する。_Bool型への代入にも型変換のNodeを挿入する。
+// 関数呼び出しの実引数は、代入と同じく引数の型に変換する。
+// mainの戻り値はint型なので、浮動小数点数を返すreturn文にもint型への変換を挿入する。
+// 型の誤りはparse時に検出されているものとする。
+func AddType(node *Node) {
+	if node == nil {
+		return
+	}
+	AddType(node.Lhs)
+	AddType(node.Rhs)
+	for _, n := range node.Body {
+		AddType(n)
+	}
+	if node.Asm != nil {
+		for _, op := range node.Asm.Operands() {
+			AddType(op.Expr)
+		}
+	}
+	switch node.Kind {
+	case Add, Sub, Mul, Div, Eq, Neq, LT, LE:
+		if node.Lhs.Type.IsArithmetic() && node.Rhs.Type.IsArithmetic() {
+			ty := usualArithmeticConversion(node.Lhs.Type, node.Rhs.Type)
+			node.Lhs = newCast(node.Lhs, ty)
+			node.Rhs = newCast(node.Rhs, ty)
+		}
+	case Assign:
+		node.Rhs = assignCast(node.Rhs, node.Lhs.Type)
+	case Call:
+		// 引数の型が分からない実引数には、既定の実引数拡張を適用する
+		params := calleeType(node.Lhs.Type).Params
+		for i, arg := range node.Body {
+			switch {
+			case i < len(params):
+				node.Body[i] = assignCast(arg, params[i])
+			case arg.Type.Kind == TyFloat:
+				node.Body[i] = newCast(arg, DoubleType)
+			case arg.Type.IsInteger():
+				node.Body[i] = newCast(arg, integerPromotion(arg.Type))
+			}
+		}
+	case Return:
+		if node.Lhs.Type.IsFlonum() {
+			node.Lhs = newCast(node.Lhs, IntType)
+		}
+	}
+	if node.Type == nil {
+		node.Type = typeOf(node)
+	}
+}
+
+// typeOf は、式のnodeの型を返す。文のnodeに対してはnilを返す。
+// parse中の型検査に使うため、nodeとその子孫のNodeには型を設定しない
+func typeOf(node *Node) *Type {
+	if node.Type != nil {
+		return node.Type
+	}
+	switch node.Kind {
+	case Num:
+		if node.Value < math.MinInt32 || math.MaxInt32 < node.Value {
+			return LongType
+		}
+		return IntType
+	case Eq, Neq, LT, LE:
+		return IntType
+	case Add, Sub, Mul, Div:
+		lty, rty := typeOf(node.Lhs), typeOf(node.Rhs)
+		if lty.IsArithmetic() && rty.IsArithmetic() {
+			return usualArithmeticConversion(lty, rty)
+		}
+		if rty.Kind == TyPtr {
+			return rty
+		}
+		return lty
+	case Assign:
+		return typeOf(node.Lhs)
+	case Comma:
+		return typeOf(node.Rhs)
+	case StmtExpr:
+		return typeOf(node.Body[len(node.Body)-1])
+	case Addr:
+		return PointerTo(typeOf(node.Lhs))
+	case Neg:
+		return typeOf(node.Lhs)
+	}
+	return nil
+}
@@ -0,0 +1,453 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nobishino/1go/ast"
+)
+
+// sourceをparseし、最後の文に型を設定して返す
+func parseLastStmt(t *testing.T, source string) *ast.Node {
+	t.Helper()
+	p, err := ast.NewTParser(source)
+	if err != nil {
+		t.Fatalf("[%q] expect error to be nil but got:\n %+v while creating parser", source, err)
+	}
+	nodes, err := p.Program()
+	if err != nil {
+		t.Fatalf("[%q] expect error to be nil but got:\n %+v", source, err)
+	}
+	node := nodes[len(nodes)-1]
+	ast.AddType(node)
+	return node
+}
+
+func TestIntegerTypeSpecifiers(t *testing.T) {
+	testcases := [...]struct {
+		source string
+		expect *ast.Type
+	}{
+		{source: "short x;x;", expect: ast.ShortType},
+		{source: "short int x;x;", expect: ast.ShortType},
+		{source: "signed short x;x;", expect: ast.ShortType},
+		{source: "unsigned short int x;x;", expect: ast.UShortType},
+		{source: "int x;x;", expect: ast.IntType},
+		{source: "signed x;x;", expect: ast.IntType},
+		{source: "unsigned x;x;", expect: ast.UIntType},
+		{source: "long x;x;", expect: ast.LongType},
+		{source: "int long unsigned x;x;", expect: ast.ULongType},
+		{source: "long long x;x;", expect: ast.LongLongType},
+		{source: "long int long x;x;", expect: ast.LongLongType},
+		{source: "unsigned long long x;x;", expect: ast.ULongLongType},
+		{source: "x;", expect: ast.LongType},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.source, func(t *testing.T) {
+			got := parseLastStmt(t, tt.source).Type
+			if got != tt.expect {
+				t.Errorf("[%q] expect type %+v but got %+v", tt.source, *tt.expect, *got)
+			}
+		})
+	}
+}
+
+func TestIntegerTypeSpecifiers_Invalid(t *testing.T) {
+	testcases := [...]string{
+		"short long x;",
+		"long long long x;",
+		"signed unsigned x;",
+		"int int x;",
+		"short short x;",
+	}
+	for _, source := range testcases {
+		t.Run(source, func(t *testing.T) {
+			p, err := ast.NewTParser(source)
+			if err != nil {
+				t.Fatalf("[%q] expect error to be nil but got:\n %+v while creating parser", source, err)
+			}
+			if _, err := p.Program(); err == nil {
+				t.Errorf("[%q] expect error to be not nil but got nil", source)
+			}
+		})
+	}
+}
+
+func TestAddType_UsualArithmeticConversion(t *testing.T) {
+	testcases := [...]struct {
+		source string
+		expect *ast.Type
+	}{
+		{source: "short a;short b;a+b;", expect: ast.IntType},
+		{source: "unsigned short a;a*1;", expect: ast.IntType},
+		{source: "int a;long b;a-b;", expect: ast.LongType},
+		{source: "unsigned int a;int b;a+b;", expect: ast.UIntType},
+		{source: "unsigned int a;long b;a+b;", expect: ast.LongType},
+		{source: "unsigned long a;long long b;a/b;", expect: ast.ULongLongType},
+		{source: "unsigned a;unsigned long b;a+b;", expect: ast.ULongType},
+		{source: "enum {X} e;e+1;", expect: ast.IntType},
+		{source: "1+2147483648;", expect: ast.LongType},
+		{source: "long a;short b;a<b;", expect: ast.IntType},
+		{source: "short a;a=1;", expect: ast.ShortType},
+		{source: "(short)1;", expect: ast.ShortType},
+		{source: "float f;int i;f+i;", expect: ast.FloatType},
+		{source: "float f;double d;f*d;", expect: ast.DoubleType},
+		{source: "unsigned long u;float f;u-f;", expect: ast.FloatType},
+		{source: "1.5f;", expect: ast.FloatType},
+		{source: "2.0;", expect: ast.DoubleType},
+		{source: "double d;d<1;", expect: ast.IntType},
+		{source: "(float)1;", expect: ast.FloatType},
+		{source: "int a[3];a+1;", expect: ast.PointerTo(ast.IntType)},
+		{source: "_Bool a;_Bool b;a+b;", expect: ast.IntType},
+		{source: "bool a;a;", expect: ast.BoolType},
+		{source: "_Bool a;a=2;", expect: ast.BoolType},
+		{source: "_Bool a;long b;a==b;", expect: ast.IntType},
+		{source: "true;", expect: ast.IntType},
+		{source: "int a[3];a[1];", expect: ast.IntType},
+		{source: "int *p;int *q;p-q;", expect: ast.LongType},
+		{source: "int a[] = {1, 2, 3};a;", expect: ast.ArrayOf(ast.IntType, 3)},
+		{source: "typedef unsigned T;(T)-1;", expect: ast.UIntType},
+		{source: "int a;(int*)&a;", expect: ast.PointerTo(ast.IntType)},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.source, func(t *testing.T) {
+			got := parseLastStmt(t, tt.source).Type
+			if diff := cmp.Diff(got, tt.expect); diff != "" {
+				t.Errorf("[%q] differs: (-got +expect)\n%s", tt.source, diff)
+			}
+		})
+	}
+}
+
+func TestAddType_InsertCast(t *testing.T) {
+	testcases := [...]struct {
+		source string
+		expect *ast.Node
+	}{
+		{
+			source: "short a;int b;a+b;",
+			expect: &ast.Node{
+				Kind: ast.Add,
+				Type: ast.IntType,
+				Lhs: &ast.Node{
+					Kind: ast.Cast,
+					Type: ast.IntType,
+					Lhs: &ast.Node{
+						Kind: ast.GlobalVar,
+						Name: "a",
+						Type: ast.ShortType,
+						Var:  &ast.GVar{Label: ".L.global.a.1", Name: "a", Type: ast.ShortType},
+					},
+				},
+				Rhs: &ast.Node{
+					Kind: ast.GlobalVar,
+					Name: "b",
+					Type: ast.IntType,
+					Var:  &ast.GVar{Label: ".L.global.b.2", Name: "b", Type: ast.IntType},
+				},
+			},
+		},
+		{
+			source: "-(long)1;",
+			expect: &ast.Node{
+				Kind: ast.Sub,
+				Type: ast.LongType,
+				Lhs: &ast.Node{
+					Kind: ast.Cast,
+					Type: ast.LongType,
+					Lhs: &ast.Node{
+						Kind: ast.Num,
+						Type: ast.IntType,
+					},
+				},
+				Rhs: &ast.Node{
+					Kind: ast.Cast,
+					Type: ast.LongType,
+					Lhs: &ast.Node{
+						Kind:  ast.Num,
+						Value: 1,
+						Type:  ast.IntType,
+					},
+				},
+			},
+		},
+		{
+			source: "double d;return d;",
+			expect: &ast.Node{
+				Kind: ast.Return,
+				Lhs: &ast.Node{
+					Kind: ast.Cast,
+					Type: ast.IntType,
+					Lhs: &ast.Node{
+						Kind: ast.GlobalVar,
+						Name: "d",
+						Type: ast.DoubleType,
+						Var:  &ast.GVar{Label: ".L.global.d.1", Name: "d", Type: ast.DoubleType},
+					},
+				},
+			},
+		},
+		{
+			source: "unsigned short a;a=1;",
+			expect: &ast.Node{
+				Kind: ast.Assign,
+				Type: ast.UShortType,
+				Lhs: &ast.Node{
+					Kind: ast.GlobalVar,
+					Name: "a",
+					Type: ast.UShortType,
+					Var:  &ast.GVar{Label: ".L.global.a.1", Name: "a", Type: ast.UShortType},
+				},
+				Rhs: &ast.Node{
+					Kind: ast.Cast,
+					Type: ast.UShortType,
+					Lhs: &ast.Node{
+						Kind:  ast.Num,
+						Value: 1,
+						Type:  ast.IntType,
+					},
+				},
+			},
+		},
+		{
+			source: "_Bool b;long *p;b=p;",
+			expect: &ast.Node{
+				Kind: ast.Assign,
+				Type: ast.BoolType,
+				Lhs: &ast.Node{
+					Kind: ast.GlobalVar,
+					Name: "b",
+					Type: ast.BoolType,
+					Var:  &ast.GVar{Label: ".L.global.b.1", Name: "b", Type: ast.BoolType},
+				},
+				Rhs: &ast.Node{
+					Kind: ast.Cast,
+					Type: ast.BoolType,
+					Lhs: &ast.Node{
+						Kind: ast.GlobalVar,
+						Name: "p",
+						Type: ast.PointerTo(ast.LongType),
+						Var:  &ast.GVar{Label: ".L.global.p.2", Name: "p", Type: ast.PointerTo(ast.LongType)},
+					},
+				},
+			},
+		},
+		{
+			source: "double f(double, long);f(1, 2.5f);",
+			expect: &ast.Node{
+				Kind: ast.Call,
+				Type: ast.DoubleType,
+				Lhs: &ast.Node{
+					Kind: ast.GlobalVar,
+					Name: "f",
+					Type: ast.FuncType(ast.DoubleType, []*ast.Type{ast.DoubleType, ast.LongType}),
+					Var: &ast.GVar{
+						Label:  "f",
+						Type:   ast.FuncType(ast.DoubleType, []*ast.Type{ast.DoubleType, ast.LongType}),
+						Extern: true,
+					},
+				},
+				Body: []*ast.Node{
+					{
+						Kind: ast.Cast,
+						Type: ast.DoubleType,
+						Lhs:  &ast.Node{Kind: ast.Num, Value: 1, Type: ast.IntType},
+					},
+					{
+						Kind: ast.Cast,
+						Type: ast.LongType,
+						Lhs:  &ast.Node{Kind: ast.Num, FVal: 2.5, Type: ast.FloatType},
+					},
+				},
+			},
+		},
+		{
+			source: "int (*fp)();float x;fp(x);",
+			expect: &ast.Node{
+				Kind: ast.Call,
+				Type: ast.IntType,
+				Lhs: &ast.Node{
+					Kind: ast.GlobalVar,
+					Name: "fp",
+					Type: ast.PointerTo(ast.FuncType(ast.IntType, nil)),
+					Var:  &ast.GVar{Label: ".L.global.fp.1", Name: "fp", Type: ast.PointerTo(ast.FuncType(ast.IntType, nil))},
+				},
+				Body: []*ast.Node{
+					{
+						Kind: ast.Cast,
+						Type: ast.DoubleType,
+						Lhs: &ast.Node{
+							Kind: ast.GlobalVar,
+							Name: "x",
+							Type: ast.FloatType,
+							Var:  &ast.GVar{Label: ".L.global.x.2", Name: "x", Type: ast.FloatType},
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.source, func(t *testing.T) {
+			got := parseLastStmt(t, tt.source)
+			if diff := cmp.Diff(got, tt.expect); diff != "" {
+				t.Errorf("input: %s\ndiffers: (-got +expect)\n%s\n", tt.source, diff)
+			}
+		})
+	}
+}
+
+func TestDeclarator(t *testing.T) {
+	intFunc := ast.FuncType(ast.IntType, []*ast.Type{ast.IntType})
+	testcases := [...]struct {
+		source string
+		expect *ast.Type
+	}{
+		{source: "int (*fp)(int, int);fp;", expect: ast.PointerTo(ast.FuncType(ast.IntType, []*ast.Type{ast.IntType, ast.IntType}))},
+		{source: "int (*fps[3])(int);fps;", expect: ast.ArrayOf(ast.PointerTo(intFunc), 3)},
+		{source: "short *(*fp)();fp;", expect: ast.PointerTo(ast.FuncType(ast.PointerTo(ast.ShortType), nil))},
+		{
+			source: "int (*fp)(int a[3], int (*)(int), long f(int));fp;",
+			expect: ast.PointerTo(ast.FuncType(ast.IntType, []*ast.Type{
+				ast.PointerTo(ast.IntType),
+				ast.PointerTo(intFunc),
+				ast.PointerTo(ast.FuncType(ast.LongType, []*ast.Type{ast.IntType})),
+			})),
+		},
+		{source: "int (*(*fp)(int))(int);fp;", expect: ast.PointerTo(ast.FuncType(ast.PointerTo(intFunc), []*ast.Type{ast.IntType}))},
+		{source: "int ((x));x;", expect: ast.IntType},
+		{source: "typedef int T;int (*fp)(T);fp;", expect: ast.PointerTo(intFunc)},
+		{source: "(int (*)(int))0;", expect: ast.PointerTo(intFunc)},
+		{source: "int a[2][3];a;", expect: ast.ArrayOf(ast.ArrayOf(ast.IntType, 3), 2)},
+		{source: "int a[2][3];a[1];", expect: ast.ArrayOf(ast.IntType, 3)},
+		{source: "int a[2][3];a+1;", expect: ast.PointerTo(ast.ArrayOf(ast.IntType, 3))},
+		{source: "int *a[3];a;", expect: ast.ArrayOf(ast.PointerTo(ast.IntType), 3)},
+		{source: "int (*p)[4];p;", expect: ast.PointerTo(ast.ArrayOf(ast.IntType, 4))},
+		{source: "int (*a[2])[3];a;", expect: ast.ArrayOf(ast.PointerTo(ast.ArrayOf(ast.IntType, 3)), 2)},
+		{source: "int (*(*p)[2])[3];p;", expect: ast.PointerTo(ast.ArrayOf(ast.PointerTo(ast.ArrayOf(ast.IntType, 3)), 2))},
+		{source: "int a[][2] = {1, 2, 3};a;", expect: ast.ArrayOf(ast.ArrayOf(ast.IntType, 2), 2)},
+		{source: "sizeof(int);", expect: ast.ULongType},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.source, func(t *testing.T) {
+			got := parseLastStmt(t, tt.source).Type
+			if diff := cmp.Diff(got, tt.expect); diff != "" {
+				t.Errorf("[%q] differs: (-got +expect)\n%s", tt.source, diff)
+			}
+		})
+	}
+}
+
+func TestQualifiers(t *testing.T) {
+	constInt := &ast.Type{Kind: ast.TyInt, Size: 4, Align: 4, Const: true, Origin: ast.IntType}
+	testcases := [...]struct {
+		source string
+		expect *ast.Type
+	}{
+		{source: "const int x;x;", expect: constInt},
+		{source: "int const x;x;", expect: constInt},
+		{source: "unsigned const volatile int x;x;", expect: &ast.Type{Kind: ast.TyInt, Size: 4, Align: 4, Unsigned: true, Const: true, Volatile: true, Origin: ast.UIntType}},
+		{source: "const int *p;p;", expect: ast.PointerTo(constInt)},
+		{source: "int *const p = 0;p;", expect: &ast.Type{Kind: ast.TyPtr, Size: 8, Align: 8, Base: ast.IntType, Const: true, Origin: ast.PointerTo(ast.IntType)}},
+		{source: "typedef const int T;T a[2];a;", expect: ast.ArrayOf(constInt, 2)},
+		{source: "const struct {int a;} s;s.a;", expect: constInt},
+		{source: "const int x;x+1;", expect: ast.IntType},
+		{source: "(const int)1;", expect: constInt},
+		{source: "_Atomic int x;x;", expect: &ast.Type{Kind: ast.TyInt, Size: 4, Align: 4, Atomic: true, Origin: ast.IntType}},
+		{source: "_Atomic(long) const x = 0;x;", expect: &ast.Type{Kind: ast.TyLong, Size: 8, Align: 8, Const: true, Atomic: true, Origin: ast.LongType}},
+		{source: "_Atomic int x;x+1;", expect: ast.IntType},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.source, func(t *testing.T) {
+			got := parseLastStmt(t, tt.source).Type
+			if diff := cmp.Diff(got, tt.expect); diff != "" {
+				t.Errorf("[%q] differs: (-got +expect)\n%s", tt.source, diff)
+			}
+		})
+	}
+}
+
+// 不完全な構造体型を修飾した型も、後の宣言で構造体が完成すれば大きさとメンバーが決まる
+func TestQualifiedIncompleteType(t *testing.T) {
+	testcases := [...]struct {
+		source string
+		expect int
+	}{
+		{source: "const struct S *p;struct S {int a;int b;};sizeof(*p);", expect: 8},
+		{source: "typedef const struct S CS;struct S {int a;int b;};CS s = {1, 2};sizeof(s);", expect: 8},
+		{source: "volatile union U *p;union U {short s;long l;};_Alignof(*p);", expect: 8},
+		{source: "typedef const struct S CS;volatile CS *p;struct S {int a[3];};sizeof(*p);", expect: 12},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.source, func(t *testing.T) {
+			got := parseLastStmt(t, tt.source)
+			if got.Kind != ast.Num || got.Value != tt.expect {
+				t.Errorf("[%q] expect number %d but got %+v", tt.source, tt.expect, *got)
+			}
+		})
+	}
+}
+
+func TestGenericSelection(t *testing.T) {
+	testcases := [...]struct {
+		source string
+		expect int
+	}{
+		{source: "_Generic(1, long: 1, int: 2, default: 3);", expect: 2},
+		{source: "_Generic(1L, long: 1, int: 2, default: 3);", expect: 1},
+		{source: "_Generic(1LL, long: 1, int: 2, default: 3);", expect: 3},
+		{source: "_Generic(1u, int: 1, unsigned: 2);", expect: 2},
+		{source: "_Generic(1.5f, double: 1, float: 2);", expect: 2},
+		{source: "const int x = 1;_Generic(x, const int: 1, int: 2);", expect: 2},
+		{source: "const int x = 1;_Generic(&x, int *: 1, const int *: 2);", expect: 2},
+		{source: "int a[3];_Generic(a, int[3]: 1, int *: 2);", expect: 2},
+		{source: "short s;_Generic(s + s, short: 1, int: 2);", expect: 2},
+		{source: "struct S {int a;} s;_Generic(s, struct {int a;}: 1, struct S: 2);", expect: 2},
+		{source: "enum E {A} e;_Generic(e, int: 1, enum E: 2);", expect: 2},
+		{source: "int (*fp)(int);_Generic(fp, int (*)(long): 1, int (*)(int): 2);", expect: 2},
+		{source: "int (*fp)(const int);_Generic(fp, int (*)(long): 1, int (*)(int): 2);", expect: 2},
+		{source: "int (*fp)(int *const);_Generic(fp, int (*)(const int *): 1, int (*)(int *): 2);", expect: 2},
+		{source: "int (*p)[3];_Generic(p, int (*)[]: 1, default: 2);", expect: 1},
+		{source: "_Bool b;_Generic(b, _Bool: 1, int: 2);", expect: 1},
+		{source: "_Generic(1 < 2, _Bool: 1, int: 2);", expect: 2},
+		{source: "_Atomic int x;_Generic(x, int: 1, default: 2);", expect: 1},
+		{source: "_Atomic int x;_Generic(&x, int *: 1, _Atomic int *: 2);", expect: 2},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.source, func(t *testing.T) {
+			got := parseLastStmt(t, tt.source)
+			if got.Kind != ast.Num || got.Value != tt.expect {
+				t.Errorf("[%q] expect number %d but got %+v", tt.source, tt.expect, *got)
+			}
+		})
+	}
+}
+
+func TestAtomicBuiltins(t *testing.T) {
+	testcases := [...]struct {
+		source string
+		kind   ast.Kind
+		order  int
+		expect *ast.Type
+	}{
+		{source: "int x;__atomic_load_n(&x, __ATOMIC_ACQUIRE);", kind: ast.AtomicLoad, order: ast.MemoryOrderAcquire, expect: ast.IntType},
+		{source: "_Atomic short x;atomic_load(&x);", kind: ast.AtomicLoad, order: ast.MemoryOrderSeqCst, expect: ast.ShortType},
+		{source: "long x;__atomic_store_n(&x, 1, __ATOMIC_RELEASE);", kind: ast.AtomicStore, order: ast.MemoryOrderRelease, expect: ast.LongType},
+		{source: "int *p;int x;atomic_exchange_explicit(&p, &x, memory_order_acq_rel);", kind: ast.AtomicExchange, order: ast.MemoryOrderAcqRel, expect: ast.PointerTo(ast.IntType)},
+		{source: "int x;int e;__atomic_compare_exchange_n(&x, &e, 1, 1, 5, 0);", kind: ast.AtomicCAS, order: ast.MemoryOrderSeqCst, expect: ast.IntType},
+		{source: "unsigned x;atomic_fetch_add_explicit(&x, 1, memory_order_relaxed);", kind: ast.AtomicFetchAdd, order: ast.MemoryOrderRelaxed, expect: ast.UIntType},
+		{source: "long x;__atomic_fetch_sub(&x, 1, 5);", kind: ast.AtomicFetchSub, order: ast.MemoryOrderSeqCst, expect: ast.LongType},
+		{source: "atomic_thread_fence(memory_order_acquire);", kind: ast.AtomicFence, order: ast.MemoryOrderAcquire, expect: ast.IntType},
+	}
+	for _, tt := range testcases {
+		t.Run(tt.source, func(t *testing.T) {
+			got := parseLastStmt(t, tt.source)
+			if got.Kind != tt.kind || got.Value != tt.order {
+				t.Errorf("[%q] expect %s with memory order %d but got %s with memory order %d", tt.source, tt.kind, tt.order, got.Kind, got.Value)
+			}
+			if diff := cmp.Diff(got.Type, tt.expect); diff != "" {
+				t.Errorf("[%q] differs: (-got +expect)\n%s", tt.source, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package c
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nobishino/1go/ast"
+)
+
+// 64bitのレジスタ名と、その下位1, 2, 4byteのレジスタ名
+var subRegs = map[string][3]string{
+	"rax": {"al", "ax", "eax"}, "rbx": {"bl", "bx", "ebx"}, "rcx": {"cl", "cx", "ecx"}, "rdx": {"dl", "dx", "edx"},
+	"rsi": {"sil", "si", "esi"}, "rdi": {"dil", "di", "edi"},
+	"r8": {"r8b", "r8w", "r8d"}, "r9": {"r9b", "r9w", "r9d"}, "r10": {"r10b", "r10w", "r10d"}, "r11": {"r11b", "r11w", "r11d"},
+	"r12": {"r12b", "r12w", "r12d"}, "r13": {"r13b", "r13w", "r13d"}, "r14": {"r14b", "r14w", "r14d"}, "r15": {"r15b", "r15w", "r15d"},
+}
+
+// 64bitのレジスタregの下位sizeバイトを表すレジスタ名を返す
+func sizedReg(reg string, size int) string {
+	switch size {
+	case 1:
+		return subRegs[reg][0]
+	case 2:
+		return subRegs[reg][1]
+	case 4:
+		return subRegs[reg][2]
+	}
+	return reg
+}
+
+// メモリオペランドの大きさの指定
+var ptrSizes = map[int]string{1: "byte", 2: "word", 4: "dword", 8: "qword"}
+
+// mainの呼び出し元のために値を保存しなければならないレジスタ
+var calleeSavedRegs = []string{"rbx", "r12", "r13", "r14", "r15"}
+
+// asm文の命令を生成する。
+// 拡張asm文では、出力オペランドのアドレスと入力オペランドの値をスタックに積んでから各オペランドのレジスタに読み込み、
+// テンプレートの命令を実行した後で出力オペランドのレジスタの値をそれぞれのアドレスに書き込む
+func genAsm(a *ast.Asm) []string {
+	if a.Basic {
+		return asmLines(a.Template)
+	}
+	var result []string
+	depth := 0 // スタックに積んだ値の個数
+	push := func(code []string) int {
+		result = append(result, code...)
+		depth++
+		return depth - 1
+	}
+	at := func(slot int) string { // slot番目に積んだ値の場所
+		return fmt.Sprintf("[rsp + %d]", 8*(depth-1-slot))
+	}
+	leftValue := func(node *ast.Node) []string {
+		code, err := genLeftValue(node)
+		if err != nil {
+			panic(err) // TODO: 適切なエラー処理を行う
+		}
+		return code
+	}
+	addr := make(map[*ast.AsmOperand]int) // アドレスを積んだ位置
+	val := make(map[*ast.AsmOperand]int)  // 値を積んだ位置
+	for _, op := range a.Outputs {
+		addr[op] = push(leftValue(op.Expr))
+	}
+	for _, op := range a.Inputs {
+		if op.Mem {
+			addr[op] = push(leftValue(op.Expr))
+			continue
+		}
+		val[op] = push(genAST(op.Expr))
+	}
+	for _, op := range a.Outputs {
+		if op.ReadWrite && !op.Mem {
+			val[op] = push(append([]string{"    push qword ptr " + at(addr[op])}, genLoad(op.Expr.Type)...))
+		}
+	}
+	slots := depth
+
+	var saved []string
+	for _, reg := range calleeSavedRegs {
+		if usesReg(a, reg) {
+			push([]string{"    push " + reg})
+			saved = append(saved, reg)
+		}
+	}
+	for _, op := range a.Operands() {
+		if op.Mem {
+			result = append(result, fmt.Sprintf("    mov %s, %s", op.Reg, at(addr[op])))
+		} else if slot, ok := val[op]; ok {
+			result = append(result, fmt.Sprintf("    mov %s, %s", op.Reg, at(slot)))
+		}
+	}
+	tmpl, err := a.Expand(asmOperandText)
+	if err != nil {
+		panic(err) // テンプレートはparse時に検査している
+	}
+	result = append(result, asmLines(tmpl)...)
+
+	var outputs []*ast.AsmOperand
+	for _, op := range a.Outputs {
+		if !op.Mem {
+			val[op] = push([]string{"    push " + op.Reg})
+			outputs = append(outputs, op)
+		}
+	}
+	for _, op := range outputs {
+		result = append(result,
+			fmt.Sprintf("    mov rax, %s", at(addr[op])),
+			fmt.Sprintf("    mov rdi, %s", at(val[op])),
+			fmt.Sprintf("    mov [rax], %s", sizedReg("rdi", op.Expr.Type.Size)),
+		)
+	}
+	if len(outputs) > 0 {
+		result = append(result, fmt.Sprintf("    add rsp, %d", 8*len(outputs)))
+	}
+	for i := len(saved) - 1; i >= 0; i-- {
+		result = append(result, "    pop "+saved[i])
+	}
+	if slots > 0 {
+		result = append(result, fmt.Sprintf("    add rsp, %d", 8*slots))
+	}
+	return result
+}
+
+// asm文aがレジスタregをオペランドに使うか、値を破壊するときtrueを返す
+func usesReg(a *ast.Asm, reg string) bool {
+	for _, op := range a.Operands() {
+		if op.Reg == reg {
+			return true
+		}
+	}
+	for _, r := range a.Clobbers {
+		if r == reg {
+			return true
+		}
+	}
+	return false
+}
+
+// テンプレートのオペランドopの参照を置き換える文字列を返す。sizeは修飾子で指定された大きさで、0であればオペランドの型の大きさを使う
+func asmOperandText(op *ast.AsmOperand, size int) string {
+	if size == 0 {
+		size = op.Expr.Type.Size
+		if k := op.Expr.Type.Kind; k == ast.TyArray || k == ast.TyFunc {
+			size = 8 // 配列と関数はアドレスで表す
+		}
+	}
+	if op.Mem {
+		if ptr, ok := ptrSizes[size]; ok {
+			return fmt.Sprintf("%s ptr [%s]", ptr, op.Reg)
+		}
+		return fmt.Sprintf("[%s]", op.Reg)
+	}
+	return sizedReg(op.Reg, size)
+}
+
+// 改行で区切られた命令を、インデントを揃えた行に分ける
+func asmLines(tmpl string) []string {
+	var lines []string
+	for _, line := range strings.Split(tmpl, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, "    "+line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,71 @@
+package c
+
+import (
+	"fmt"
+
+	"github.com/nobishino/1go/ast"
+)
+
+// アトミック操作の組み込み関数の命令を生成する。
+// x86-64では整列された8byte以下の読み書きはそれ自体がアトミックで、読み出しの後の読み書きと書き込みの後の書き込みは
+// 順序が入れ替わらない。そのためseq_cstの書き込みの後にだけmfenceが必要になる。
+// 読み出しと書き込みを組み合わせる操作はlockプレフィックス付きの命令で行い、これらは全てのメモリオーダーを満たす
+func genAtomic(node *ast.Node) []string {
+	var result []string
+	switch node.Kind {
+	case ast.AtomicLoad:
+		result = append(result, genAST(node.Lhs)...)
+		return append(result, genLoad(node.Type)...)
+	case ast.AtomicStore:
+		result = append(result, genAST(node.Lhs)...)
+		result = append(result, genAST(node.Rhs)...)
+		result = append(result, genStore(node.Type)...)
+		if node.Value == ast.MemoryOrderSeqCst {
+			result = append(result, "    mfence") // 後続の読み出しが書き込みより先に行われないようにする
+		}
+		return result
+	case ast.AtomicExchange, ast.AtomicFetchAdd, ast.AtomicFetchSub:
+		size := node.Type.Size
+		result = append(result, genAST(node.Lhs)...)
+		result = append(result, genAST(node.Rhs)...)
+		result = append(result,
+			"    pop rdi", // 書き込む値
+			"    pop rax", // オブジェクトのアドレス
+		)
+		switch node.Kind {
+		case ast.AtomicExchange:
+			result = append(result, fmt.Sprintf("    xchg [rax], %s", sizedReg("rdi", size))) // メモリを対象とするxchgは暗黙にロックされる
+		case ast.AtomicFetchSub:
+			result = append(result, "    neg rdi")
+			fallthrough
+		case ast.AtomicFetchAdd:
+			result = append(result, fmt.Sprintf("    lock xadd [rax], %s", sizedReg("rdi", size))) // 元の値がdiに入る
+		}
+		result = append(result, "    push rdi")
+		return append(result, genConvert(node.Type)...)
+	case ast.AtomicCAS:
+		size := node.Lhs.Type.Base.Size
+		result = append(result, genAST(node.Lhs)...)
+		result = append(result, genAST(node.Body[0])...)
+		result = append(result, genAST(node.Rhs)...)
+		return append(result,
+			"    pop rdx", // 書き込む値
+			"    pop rsi", // 期待値のアドレス
+			"    pop rdi", // オブジェクトのアドレス
+			fmt.Sprintf("    mov %s, [rsi]", sizedReg("rax", size)),
+			fmt.Sprintf("    lock cmpxchg [rdi], %s", sizedReg("rdx", size)), // 等しければ書き込み、等しくなければ現在の値をaxに読み出す
+			"    sete cl",
+			"    jz 1f",
+			fmt.Sprintf("    mov [rsi], %s", sizedReg("rax", size)), // 失敗したときは現在の値を期待値に書き戻す
+			"1:",
+			"    movzx eax, cl",
+			"    push rax",
+		)
+	case ast.AtomicFence:
+		if node.Value == ast.MemoryOrderSeqCst {
+			result = append(result, "    mfence")
+		}
+		return append(result, "    push 0")
+	}
+	panic(fmt.Sprintf("unexpected atomic node %q", node.Kind))
+}
@@ -2,6 +2,8 @@ package c
 
 import (
 	"fmt"
+	"math"
+	"sort"
 	"strings"
 
 	"github.com/nobishino/1go/ast"
@@ -18,11 +20,14 @@ func Compile(src string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	result := Gen(parsed, p.GetOffset())
+	for _, node := range parsed {
+		ast.AddType(node)
+	}
+	result := Gen(parsed, p.GetOffset(), p.Globals())
 	return strings.Join(result, "\n"), nil
 }
 
-func Gen(nodes []*ast.Node, offset int) []string {
+func Gen(nodes []*ast.Node, offset int, globals []*ast.GVar) []string {
 	if nodes == nil {
 		return nil
 	}
@@ -34,13 +39,64 @@ func Gen(nodes []*ast.Node, offset int) []string {
 	}
 	result = append(result, genPrologue(offset)...)
 	for _, node := range nodes {
-		result = append(result, genAST(node)...)
+		result = append(result, genStmt(node)...)
 	}
 	result = append(result, epilogue...)
+	result = append(result, genData(globals)...)
 	result = append(result, "")
 	return result
 }
 
+// 静的記憶域期間を持つ変数の領域を確保する。初期値がある変数は.dataに、ない変数は.bssに置く。
+// スレッド記憶域期間を持つ変数は、それぞれ.tdataと.tbssに置く。
+// 他のオブジェクトファイルで定義された変数の領域は確保しない
+func genData(globals []*ast.GVar) []string {
+	var result []string
+	for _, g := range globals {
+		if g.Extern {
+			continue
+		}
+		if g.Init == nil {
+			section := "    .bss"
+			if g.ThreadLocal {
+				section = "    .section .tbss,\"awT\",@nobits"
+			}
+			result = append(result,
+				section,
+				fmt.Sprintf("    .balign %d", g.Type.Align),
+			)
+			result = append(result, genDataLabels(g)...)
+			result = append(result, fmt.Sprintf("    .zero %d", g.Type.Size))
+			continue
+		}
+		section := "    .data"
+		if g.ThreadLocal {
+			section = "    .section .tdata,\"awT\",@progbits"
+		}
+		result = append(result,
+			section,
+			fmt.Sprintf("    .balign %d", g.Type.Align),
+		)
+		result = append(result, genDataLabels(g)...)
+		for _, b := range g.Init {
+			result = append(result, fmt.Sprintf("    .byte %d", b))
+		}
+	}
+	return result
+}
+
+// 変数gの領域の先頭に置くラベルを生成する。外部結合を持つ変数は、その名前のシンボルも公開する
+func genDataLabels(g *ast.GVar) []string {
+	if g.Name == "" {
+		return []string{g.Label + ":"}
+	}
+	return []string{
+		g.Label + ":",
+		fmt.Sprintf("    .globl %s", g.Name),
+		g.Name + ":",
+	}
+}
+
 // 指定したローカル変数オフセットから関数プロローグを生成する
 func genPrologue(offset int) []string {
 	return []string{
@@ -50,13 +106,204 @@ func genPrologue(offset int) []string {
 	}
 }
 
+// 文のNodeから命令を生成する。文の実行前後でスタックの高さは変わらない
+func genStmt(node *ast.Node) []string {
+	var result []string
+	switch node.Kind {
+	case ast.Return:
+		result = append(result, genAST(node.Lhs)...)
+		result = append(result, ret...)
+	case ast.Goto, ast.Break, ast.Continue:
+		result = append(result, fmt.Sprintf("    jmp %s", node.Label))
+	case ast.Label, ast.Case, ast.Default:
+		result = append(result, node.Label+":")
+		result = append(result, genStmt(node.Lhs)...)
+	case ast.Block:
+		for _, stmt := range node.Body {
+			result = append(result, genStmt(stmt)...)
+		}
+	case ast.Switch:
+		result = append(result, genAST(node.Lhs)...)
+		result = append(result, "    pop rax")
+		result = append(result, genSwitchDispatch(node)...)
+		result = append(result, genStmt(node.Rhs)...)
+		result = append(result, node.Label+":")
+	case ast.DoWhile:
+		begin := node.Label + ".begin"
+		result = append(result, begin+":")
+		result = append(result, genStmt(node.Lhs)...)
+		result = append(result, node.ContLabel+":") // continueは条件式の評価から再開する
+		result = append(result, genAST(node.Rhs)...)
+		result = append(result, genTruth(node.Rhs.Type)...)
+		result = append(result,
+			"    pop rax",
+			"    cmp rax, 0",
+			fmt.Sprintf("    jne %s", begin),
+		)
+		result = append(result, node.Label+":")
+	case ast.AsmStmt:
+		result = append(result, genAsm(node.Asm)...)
+	case ast.MemZero:
+		pushMemAddr, err := genLeftValue(node.Lhs)
+		if err != nil {
+			panic(err) // TODO: 適切なエラー処理を行う
+		}
+		result = append(result, pushMemAddr...)
+		result = append(result,
+			"    pop rdi",
+			fmt.Sprintf("    mov rcx, %d", node.Lhs.Type.Size),
+			"    xor eax, eax",
+			"    rep stosb", // rdiからrcxバイトをalの値で埋める
+		)
+	default: // 式文
+		result = append(result, genAST(node)...)
+		result = append(result, "    pop rax") // 評価結果を捨てる。最後の文の評価結果はraxに残りmainの戻り値になる
+	}
+	return result
+}
+
+// case値の個数がjumpTableMinCases以上で、値の範囲がcase数のjumpTableMaxSpread倍以下であれば
+// switch文をジャンプテーブルで実装する。それ以外の場合は比較の連鎖で実装する
+const (
+	jumpTableMinCases  = 4
+	jumpTableMaxSpread = 3
+)
+
+// raxに入っているswitch文の条件式の値から、対応するcaseラベルへジャンプする命令を生成する
+func genSwitchDispatch(node *ast.Node) []string {
+	fallback := node.Label // defaultラベルがなければswitch文を抜ける
+	cases := make(map[int]string)
+	var values []int
+	for _, c := range node.Cases {
+		if c.Kind == ast.Default {
+			fallback = c.Label
+			continue
+		}
+		cases[c.Value] = c.Label
+		values = append(values, c.Value)
+	}
+	if len(values) == 0 {
+		return []string{fmt.Sprintf("    jmp %s", fallback)}
+	}
+	sort.Ints(values)
+	min, max := values[0], values[len(values)-1]
+	spread := uint64(max - min) // case値の範囲の広さ - 1
+	if len(values) < jumpTableMinCases || spread >= uint64(len(values)*jumpTableMaxSpread) {
+		var result []string
+		for _, v := range values {
+			result = append(result,
+				fmt.Sprintf("    mov rdi, %d", v),
+				"    cmp rax, rdi",
+				fmt.Sprintf("    je %s", cases[v]),
+			)
+		}
+		return append(result, fmt.Sprintf("    jmp %s", fallback))
+	}
+
+	// ジャンプテーブルは位置独立にするため、テーブル先頭からの相対位置を格納する
+	table := node.Label + ".table"
+	result := []string{
+		fmt.Sprintf("    mov rdi, %d", min),
+		"    sub rax, rdi", // テーブルのインデックスに変換する
+		fmt.Sprintf("    cmp rax, %d", spread),
+		fmt.Sprintf("    ja %s", fallback), // 符号なし比較なのでminより小さい値もここで除かれる
+		fmt.Sprintf("    lea rdi, [rip + %s]", table),
+		"    movsxd rax, dword ptr [rdi + rax*4]",
+		"    add rax, rdi",
+		"    jmp rax",
+		"    .section .rodata",
+		"    .balign 4",
+		table + ":",
+	}
+	for v := min; v <= max; v++ {
+		label, ok := cases[v]
+		if !ok {
+			label = fallback
+		}
+		result = append(result, fmt.Sprintf("    .long %s - %s", label, table))
+	}
+	return append(result, "    .text")
+}
+
+// 式のNodeから、評価結果を1つスタックにpushする命令を生成する
 func genAST(node *ast.Node) []string {
 	if node == nil {
 		return nil
 	}
 	var result []string
+	switch node.Kind {
+	case ast.LocalVar, ast.GlobalVar, ast.MemberAccess:
+		pushMemAddr, err := genLeftValue(node)
+		if err != nil {
+			panic(err) // TODO: 適切なエラー処理を行う
+		}
+		result = append(result, pushMemAddr...)
+		result = append(result, genLoad(node.Type)...)
+		if node.Kind == ast.MemberAccess && node.Member.IsBitfield {
+			result = append(result, genBitfieldExtract(node.Member)...)
+		}
+		return result
+	case ast.Deref:
+		result = append(result, genAST(node.Lhs)...)
+		result = append(result, genLoad(node.Type)...)
+		return result
+	case ast.Addr:
+		pushMemAddr, err := genLeftValue(node.Lhs)
+		if err != nil {
+			panic(err) // TODO: 適切なエラー処理を行う
+		}
+		return pushMemAddr
+	case ast.Assign:
+		pushMemAddr, err := genLeftValue(node.Lhs)
+		if err != nil {
+			panic(err) // TODO: 適切なエラー処理を行う
+		}
+		result = append(result, pushMemAddr...)
+		result = append(result, genAST(node.Rhs)...) // 右辺のノードを評価する
+		if node.Lhs.Kind == ast.MemberAccess && node.Lhs.Member.IsBitfield {
+			return append(result, genBitfieldStore(node.Lhs.Member)...)
+		}
+		result = append(result, genStore(node.Type)...) // 代入命令を生成する
+		if node.Lhs.Type.Atomic {
+			result = append(result, "    mfence") // _Atomic修飾されたオブジェクトへの代入はseq_cstの書き込みになる
+		}
+		return result
+	case ast.AtomicLoad, ast.AtomicStore, ast.AtomicExchange, ast.AtomicCAS, ast.AtomicFetchAdd, ast.AtomicFetchSub, ast.AtomicFence:
+		return genAtomic(node)
+	case ast.Comma:
+		result = append(result, genStmt(node.Lhs)...)
+		return append(result, genAST(node.Rhs)...)
+	case ast.StmtExpr:
+		if node.Type.Kind == ast.TyVoid {
+			for _, stmt := range node.Body {
+				result = append(result, genStmt(stmt)...)
+			}
+			return append(result, "    push rax") // 値は使われないが、式文が捨てる値として最後の文の評価結果をそのまま積む
+		}
+		last := len(node.Body) - 1
+		for _, stmt := range node.Body[:last] {
+			result = append(result, genStmt(stmt)...)
+		}
+		return append(result, genAST(node.Body[last])...) // 最後の式文の値を捨てずに残す
+	case ast.Cast:
+		result = append(result, genAST(node.Lhs)...)
+		result = append(result, genCast(node.Lhs.Type, node.Type)...)
+		return result
+	case ast.Neg:
+		result = append(result, genAST(node.Lhs)...)
+		return append(result, genFloatNeg(node.Type)...)
+	case ast.Call:
+		return genCall(node)
+	case ast.Num:
+		if node.Type != nil && node.Type.IsFlonum() {
+			return genFloatNum(node)
+		}
+	}
 	result = append(result, genAST(node.Lhs)...)
 	result = append(result, genAST(node.Rhs)...)
+	if node.Lhs != nil && node.Lhs.Type.IsFlonum() { // 両辺は通常の算術型変換によって同じ型になっている
+		return append(result, genFloatBinary(node.Kind, node.Lhs.Type)...)
+	}
 
 	switch node.Kind {
 	case ast.Add:
@@ -66,41 +313,483 @@ func genAST(node *ast.Node) []string {
 	case ast.Mul:
 		result = append(result, mul...)
 	case ast.Div:
-		result = append(result, div...)
+		if isUnsigned(node.Lhs.Type) {
+			result = append(result, udiv...)
+		} else {
+			result = append(result, div...)
+		}
 	case ast.Eq:
 		result = append(result, eq...)
 	case ast.Neq:
 		result = append(result, neq...)
 	case ast.LT:
-		result = append(result, lt...)
+		if isUnsigned(node.Lhs.Type) {
+			result = append(result, ltu...)
+		} else {
+			result = append(result, lt...)
+		}
 	case ast.LE:
-		result = append(result, le...)
+		if isUnsigned(node.Lhs.Type) {
+			result = append(result, leu...)
+		} else {
+			result = append(result, le...)
+		}
 	case ast.Num:
-		result = append(result, fmt.Sprintf("    push %d", node.Value))
-	case ast.Assign:
-		pushMemAddr, err := genLeftValue(node.Lhs)
-		if err != nil {
-			panic(err) // TODO: 適切なエラー処理を行う
+		if math.MinInt32 <= node.Value && node.Value <= math.MaxInt32 {
+			result = append(result, fmt.Sprintf("    push %d", node.Value))
+		} else {
+			// pushは32bitの即値しか取れない
+			result = append(result, fmt.Sprintf("    mov rax, %d", node.Value), "    push rax")
 		}
-		result = append(result, pushMemAddr...)
-		result = append(result, genAST(node.Rhs)...)  // 右辺のノードを評価する
-		result = append(result, assignRightToLeft...) // 代入命令を生成する
-	case ast.Return:
-		result = append(result, ret...)
+	}
+	switch node.Kind {
+	case ast.Add, ast.Sub, ast.Mul, ast.Div:
+		result = append(result, genConvert(node.Type)...) // 演算結果を結果の型の範囲に収める
 	}
 	return result
 }
 
-// ローカル変数値(左辺値)のメモリアドレスをスタックにプッシュする命令を生成する
+// System V ABIで整数とポインタの引数を渡すレジスタ
+var argRegs = []string{"rdi", "rsi", "rdx", "rcx", "r8", "r9"}
+
+// 関数呼び出しの命令を生成する。実引数を左から順に評価してスタックに積み、最後に呼び出す関数のアドレスを積む。
+// それをraxに、実引数を整数はargRegs、浮動小数点数はxmm0から順にSystem V ABIの引数レジスタに移し、
+// rspを16byte境界に揃えてから呼び出す。戻り値はraxまたはxmm0から取り出してスタックに積む
+func genCall(node *ast.Node) []string {
+	var result []string
+	for _, arg := range node.Body {
+		result = append(result, genAST(arg)...)
+	}
+	result = append(result, genAST(node.Lhs)...) // 関数へのポインタの値
+	result = append(result, "    pop rax")
+	regs := make([]string, len(node.Body))
+	ints, floats := 0, 0
+	for i, arg := range node.Body {
+		if arg.Type.IsFlonum() {
+			regs[i] = fmt.Sprintf("xmm%d", floats)
+			floats++
+			continue
+		}
+		regs[i] = argRegs[ints]
+		ints++
+	}
+	for i := len(regs) - 1; i >= 0; i-- {
+		if strings.HasPrefix(regs[i], "xmm") {
+			result = append(result, "    pop r11", fmt.Sprintf("    movq %s, r11", regs[i]))
+			continue
+		}
+		result = append(result, "    pop "+regs[i])
+	}
+	result = append(result,
+		"    mov r11, rsp", // スタックに積んだ値の数によらず、呼び出し時のrspを16の倍数にする
+		"    and rsp, -16",
+		"    push r11",
+		"    sub rsp, 8",
+		"    call rax",
+		"    add rsp, 8",
+		"    pop rsp",
+	)
+	switch {
+	case node.Type.Kind == ast.TyDouble:
+		result = append(result, "    movq rax, xmm0")
+	case node.Type.Kind == ast.TyFloat:
+		result = append(result, "    movd eax, xmm0") // 上位32bitはゼロになる
+	case node.Type.Kind == ast.TyBool:
+		result = append(result, "    movzx eax, al") // _Boolの戻り値はalにだけ設定される
+	}
+	result = append(result, "    push rax")
+	return append(result, genConvert(node.Type)...) // 戻り値の上位ビットは不定なので拡張し直す
+}
+
+// tyが符号なしで比較・除算する型であるときtrueを返す
+func isUnsigned(ty *ast.Type) bool {
+	return ty.Unsigned || ty.Kind == ast.TyPtr || ty.Kind == ast.TyArray
+}
+
+// 浮動小数点数の定数をスタックにpushする命令を生成する。
+// 浮動小数点数の値は、そのビット列を整数レジスタに入れた形でスタックに保持する
+func genFloatNum(node *ast.Node) []string {
+	var bits uint64
+	if node.Type.Kind == ast.TyFloat {
+		bits = uint64(math.Float32bits(float32(node.FVal)))
+	} else {
+		bits = math.Float64bits(node.FVal)
+	}
+	return []string{
+		fmt.Sprintf("    mov rax, %d", bits),
+		"    push rax",
+	}
+}
+
+// スタックトップの浮動小数点数型tyの値の符号bitを反転する命令を生成する
+func genFloatNeg(ty *ast.Type) []string {
+	if ty.Kind == ast.TyFloat {
+		return []string{"    pop rax", "    xor eax, 0x80000000", "    push rax"}
+	}
+	return []string{
+		"    pop rax",
+		"    mov rdi, 0x8000000000000000",
+		"    xor rax, rdi",
+		"    push rax",
+	}
+}
+
+// スタックに積まれた浮動小数点数型tyの2つの値に対する二項演算の命令を生成する。
+// 左辺値をxmm0、右辺値をxmm1に移して演算する
+func genFloatBinary(kind ast.Kind, ty *ast.Type) []string {
+	sx := "sd" // 命令の接尾辞. scalar double
+	if ty.Kind == ast.TyFloat {
+		sx = "ss" // scalar single
+	}
+	result := []string{
+		"    pop rdi",
+		"    pop rax",
+		"    movq xmm0, rax",
+		"    movq xmm1, rdi",
+	}
+	switch kind {
+	case ast.Add, ast.Sub, ast.Mul, ast.Div:
+		op := map[ast.Kind]string{ast.Add: "add", ast.Sub: "sub", ast.Mul: "mul", ast.Div: "div"}[kind]
+		result = append(result, fmt.Sprintf("    %s%s xmm0, xmm1", op, sx))
+		if ty.Kind == ast.TyFloat {
+			return append(result, "    movd eax, xmm0", "    push rax") // 上位32bitはゼロにする
+		}
+		return append(result, "    movq rax, xmm0", "    push rax")
+	case ast.Eq:
+		// 比較できない(NaNを含む)場合はPF=1になる
+		result = append(result,
+			fmt.Sprintf("    ucomi%s xmm0, xmm1", sx),
+			"    sete al",
+			"    setnp dl",
+			"    and al, dl",
+		)
+	case ast.Neq:
+		result = append(result,
+			fmt.Sprintf("    ucomi%s xmm0, xmm1", sx),
+			"    setne al",
+			"    setp dl",
+			"    or al, dl",
+		)
+	case ast.LT:
+		// ucomisは符号なし整数の比較と同じようにフラグを設定する。比較できない場合はCF=1になるので偽になる
+		result = append(result,
+			fmt.Sprintf("    ucomi%s xmm1, xmm0", sx),
+			"    seta al",
+		)
+	case ast.LE:
+		result = append(result,
+			fmt.Sprintf("    ucomi%s xmm1, xmm0", sx),
+			"    setae al",
+		)
+	}
+	return append(result, "    movzb rax, al", "    push rax")
+}
+
+// スタックトップの型tyの値を、条件として0と比較できる値に変換する命令を生成する。
+// 浮動小数点数は、-0.0も偽になるよう0または1に変換する
+func genTruth(ty *ast.Type) []string {
+	if !ty.IsFlonum() {
+		return nil
+	}
+	return append([]string{"    push 0"}, genFloatBinary(ast.Neq, ty)...) // 0のビット列は0.0を表す
+}
+
+// 左辺値のメモリアドレスをスタックにプッシュする命令を生成する
 func genLeftValue(node *ast.Node) ([]string, error) {
-	if node.Kind != ast.LocalVar {
-		return nil, xerrors.Errorf("expect left value but got node of kind %q", node.Kind)
+	switch node.Kind {
+	case ast.LocalVar:
+		return []string{
+			"    mov rax, rbp",                          // ベースポインタの値をraxにコピーする
+			fmt.Sprintf("    sub rax, %d", node.Offset), // ベースポインタの値から変数名で決まるオフセットを引く
+			"    push rax",
+		}, nil
+	case ast.GlobalVar:
+		if node.Var.ThreadLocal {
+			// スレッドポインタ(fs:0に自身のアドレスが入っている)からのオフセットで参照する(local-exec)。
+			// オフセットはリンク時に決まるので、変数は実行ファイル自身に含まれていなければならない
+			return []string{
+				"    mov rax, qword ptr fs:0",
+				fmt.Sprintf("    lea rax, [rax + %s@tpoff + %d]", node.Var.Label, node.Offset),
+				"    push rax",
+			}, nil
+		}
+		if node.Var.Extern {
+			// 共有ライブラリなど他のモジュールで定義された変数のアドレスは、GOTから読み出す
+			return []string{
+				fmt.Sprintf("    mov rax, [rip + %s@GOTPCREL]", node.Var.Label),
+				"    push rax",
+			}, nil
+		}
+		return []string{
+			fmt.Sprintf("    lea rax, [rip + %s + %d]", node.Var.Label, node.Offset),
+			"    push rax",
+		}, nil
+	case ast.Deref:
+		return genAST(node.Lhs), nil // ポインタの値がそのままメモリアドレスになる
+	case ast.Comma:
+		result := genStmt(node.Lhs)
+		addr, err := genLeftValue(node.Rhs)
+		if err != nil {
+			return nil, err
+		}
+		return append(result, addr...), nil
+	case ast.StmtExpr:
+		if node.Type.IsAggregate() { // 構造体と共用体の値はメモリアドレスで表されている
+			return genAST(node), nil
+		}
+	case ast.MemberAccess:
+		result, err := genLeftValue(node.Lhs)
+		if err != nil {
+			return nil, err
+		}
+		return append(result,
+			"    pop rax",
+			fmt.Sprintf("    add rax, %d", node.Member.Offset), // 構造体の先頭アドレスにメンバーのオフセットを足す
+			"    push rax",
+		), nil
+	}
+	return nil, xerrors.Errorf("expect left value but got node of kind %q", node.Kind)
+}
+
+// スタックトップのメモリアドレスにある型tyの値を読み出す命令を生成する。
+// 構造体と共用体の値はメモリアドレスのまま扱い、配列は先頭要素へのポインタ、関数は関数へのポインタとして扱うので何もしない
+func genLoad(ty *ast.Type) []string {
+	if ty.IsAggregate() || ty.Kind == ast.TyArray || ty.Kind == ast.TyFunc {
+		return nil
+	}
+	var mov string
+	switch {
+	case ty.Size == 1:
+		mov = "    movzx eax, byte ptr [rax]" // 1byteの型は_Boolだけで、0か1の値しか取らない
+	case ty.Size == 2 && ty.Unsigned:
+		mov = "    movzx eax, word ptr [rax]"
+	case ty.Size == 2:
+		mov = "    movsx rax, word ptr [rax]"
+	case ty.Size == 4 && (ty.Unsigned || ty.IsFlonum()):
+		mov = "    mov eax, dword ptr [rax]" // 32bitレジスタへのmovは上位32bitをゼロにする
+	case ty.Size == 4:
+		mov = "    movsxd rax, dword ptr [rax]"
+	default:
+		mov = "    mov rax, [rax]"
+	}
+	return []string{
+		"    pop rax", // 変数のメモリアドレス
+		mov,           // メモリアドレスから値を読み出し、64bitに拡張する
+		"    push rax",
+	}
+}
+
+// スタックトップの整数値を型tyの値に変換する命令を生成する。
+// スタック上の整数値は常に、その型に従って64bitに符号拡張またはゼロ拡張した形で保持するので、
+// 変換先の型の幅に切り詰めてから拡張し直せばよい
+func genConvert(ty *ast.Type) []string {
+	if !ty.IsInteger() {
+		return nil
+	}
+	var ext string
+	switch {
+	case ty.Size == 2 && ty.Unsigned:
+		ext = "    movzx eax, ax"
+	case ty.Size == 2:
+		ext = "    movsx rax, ax"
+	case ty.Size == 4 && ty.Unsigned:
+		ext = "    mov eax, eax"
+	case ty.Size == 4:
+		ext = "    movsxd rax, eax"
+	default:
+		return nil
+	}
+	return []string{
+		"    pop rax",
+		ext,
+		"    push rax",
+	}
+}
+
+// スタックトップの型fromの値を型toの値に変換する命令を生成する
+func genCast(from, to *ast.Type) []string {
+	if to.Kind == ast.TyBool {
+		return genToBool(from)
+	}
+	if !from.IsFlonum() && !to.IsFlonum() {
+		return genConvert(to)
+	}
+	if from.Kind == to.Kind {
+		return nil
+	}
+	result := []string{"    pop rax"}
+	switch {
+	case from.Kind == ast.TyFloat && to.Kind == ast.TyDouble:
+		result = append(result, "    movq xmm0, rax", "    cvtss2sd xmm0, xmm0", "    movq rax, xmm0")
+	case from.Kind == ast.TyDouble && to.Kind == ast.TyFloat:
+		result = append(result, "    movq xmm0, rax", "    cvtsd2ss xmm0, xmm0", "    movd eax, xmm0")
+	case from.IsFlonum(): // 浮動小数点数から整数への変換は0方向に切り捨てる
+		sx, limit := "sd", "0x43e0000000000000" // 2^63のdoubleのbit列
+		if from.Kind == ast.TyFloat {
+			sx, limit = "ss", "0x5f000000"
+		}
+		result = append(result, "    movq xmm0, rax")
+		if to.Unsigned && to.Size == 8 {
+			// cvttsd2siは符号付きとして変換するので、2^63以上の値は2^63を引いてから変換し、最上位bitを立てる
+			result = append(result,
+				fmt.Sprintf("    mov rax, %s", limit),
+				"    movq xmm1, rax",
+				fmt.Sprintf("    comi%s xmm0, xmm1", sx),
+				"    jae 1f",
+				fmt.Sprintf("    cvtt%s2si rax, xmm0", sx),
+				"    jmp 2f",
+				"1:",
+				fmt.Sprintf("    sub%s xmm0, xmm1", sx),
+				fmt.Sprintf("    cvtt%s2si rax, xmm0", sx),
+				"    mov rdi, 0x8000000000000000",
+				"    xor rax, rdi",
+				"2:",
+			)
+		} else {
+			result = append(result, fmt.Sprintf("    cvtt%s2si rax, xmm0", sx))
+		}
+		result = append(result, "    push rax")
+		return append(result, genConvert(to)...)
+	default: // 整数から浮動小数点数への変換
+		sx := "sd"
+		if to.Kind == ast.TyFloat {
+			sx = "ss"
+		}
+		if from.Unsigned && from.Size == 8 {
+			// cvtsi2sdは符号付きとして変換するので、最上位bitが立っている値は半分にしてから変換して2倍する。
+			// 丸めの結果が変わらないよう、捨てる最下位bitは残りのbitとORしておく
+			result = append(result,
+				"    test rax, rax",
+				"    js 1f",
+				fmt.Sprintf("    cvtsi2%s xmm0, rax", sx),
+				"    jmp 2f",
+				"1:",
+				"    mov rdi, rax",
+				"    and eax, 1",
+				"    shr rdi",
+				"    or rdi, rax",
+				fmt.Sprintf("    cvtsi2%s xmm0, rdi", sx),
+				fmt.Sprintf("    add%s xmm0, xmm0", sx),
+				"2:",
+			)
+		} else {
+			// スタック上の整数値は64bitに拡張されているので、符号付き64bit整数として変換すればよい
+			result = append(result, fmt.Sprintf("    cvtsi2%s xmm0, rax", sx))
+		}
+		if to.Kind == ast.TyFloat {
+			result = append(result, "    movd eax, xmm0")
+		} else {
+			result = append(result, "    movq rax, xmm0")
+		}
+	}
+	return append(result, "    push rax")
+}
+
+// スタックトップにある格納単位の値から、ビットフィールドのメンバーmの値を取り出す命令を生成する。
+// 左シフトでビットフィールドの上にあるビットを捨て、右シフトで符号拡張またはゼロ拡張する
+func genBitfieldExtract(m *ast.Member) []string {
+	shr := "sar"
+	if m.Type.Unsigned {
+		shr = "shr"
 	}
 	return []string{
-		"    mov rax, rbp",                          // ベースポインタの値をraxにコピーする
-		fmt.Sprintf("    sub rax, %d", node.Offset), // ベースポインタの値から変数名で決まるオフセットを引く
+		"    pop rax",
+		fmt.Sprintf("    shl rax, %d", 64-m.BitWidth-m.BitOffset),
+		fmt.Sprintf("    %s rax, %d", shr, 64-m.BitWidth),
 		"    push rax",
-	}, nil
+	}
+}
+
+// スタックトップの値を、その1つ下にあるメモリアドレスの格納単位のビットフィールドのメンバーmに書き込む命令を生成する。
+// 格納単位の他のビットは変えずに残し、代入式の値としてビットフィールドに収まるよう切り詰めた値をpushする
+func genBitfieldStore(m *ast.Member) []string {
+	var load, store string
+	switch m.Type.Size {
+	case 1:
+		load, store = "    movzx r10d, byte ptr [rax]", "    mov [rax], r10b"
+	case 2:
+		load, store = "    movzx r10d, word ptr [rax]", "    mov [rax], r10w"
+	case 4:
+		load, store = "    mov r10d, dword ptr [rax]", "    mov [rax], r10d"
+	default:
+		load, store = "    mov r10, [rax]", "    mov [rax], r10"
+	}
+	mask := uint64(1)<<uint(m.BitWidth) - 1
+	result := []string{
+		"    pop rdi", // 右辺値
+		"    pop rax", // 格納単位のメモリアドレス
+		"    push rdi",
+		fmt.Sprintf("    mov r9, 0x%x", mask),
+		"    and rdi, r9",
+		fmt.Sprintf("    shl rdi, %d", m.BitOffset),
+		load,
+		fmt.Sprintf("    mov r9, 0x%x", ^(mask << uint(m.BitOffset))),
+		"    and r10, r9", // ビットフィールドの位置のビットを0にする
+		"    or r10, rdi",
+		store,
+	}
+	return append(result, genBitfieldExtract(&ast.Member{Type: m.Type, BitWidth: m.BitWidth})...)
+}
+
+// スタックトップの型fromの値を、0と等しければ0、それ以外は1の_Bool型の値に変換する命令を生成する
+func genToBool(from *ast.Type) []string {
+	if from.Kind == ast.TyBool {
+		return nil
+	}
+	if from.IsFlonum() {
+		return genTruth(from)
+	}
+	return []string{
+		"    pop rax",
+		"    cmp rax, 0",
+		"    setne al",
+		"    movzx eax, al",
+		"    push rax",
+	}
+}
+
+// スタックトップの値を、その1つ下にあるメモリアドレスに型tyの値として書き込む命令を生成する
+func genStore(ty *ast.Type) []string {
+	if !ty.IsAggregate() {
+		var mov string
+		switch ty.Size {
+		case 1:
+			mov = "    mov [rax], dil"
+		case 2:
+			mov = "    mov [rax], di"
+		case 4:
+			mov = "    mov [rax], edi"
+		default:
+			mov = "    mov [rax], rdi"
+		}
+		return []string{
+			"    pop rdi",  // 右辺値(評価結果)
+			"    pop rax",  // 左辺値のメモリアドレス
+			mov,            // 左辺値のメモリ位置に右辺値の下位から型のサイズ分をコピーする
+			"    push rdi", // 代入された値は代入式自体の値になるのでスタックにpushする
+		}
+	}
+	// 構造体と共用体はメモリアドレスで表されているので、右辺の値の中身を左辺のメモリアドレスにコピーする
+	result := []string{
+		"    pop rdi", // 右辺の値のメモリアドレス
+		"    pop rax", // 左辺の値のメモリアドレス
+	}
+	for i := 0; i < ty.Size; {
+		if ty.Size-i >= 8 {
+			result = append(result,
+				fmt.Sprintf("    mov r8, [rdi + %d]", i),
+				fmt.Sprintf("    mov [rax + %d], r8", i),
+			)
+			i += 8
+			continue
+		}
+		result = append(result,
+			fmt.Sprintf("    mov r8b, [rdi + %d]", i),
+			fmt.Sprintf("    mov [rax + %d], r8b", i),
+		)
+		i++
+	}
+	return append(result, "    push rax") // 代入式の値は左辺の値になる
 }
 
 var headers = []string{
@@ -138,6 +827,14 @@ var div = []string{
 	"    push rax",
 }
 
+var udiv = []string{
+	"    pop rdi",
+	"    pop rax",
+	"    xor edx, edx", // 符号なし除算では被除数の上位64bitをゼロにする
+	"    div rdi",
+	"    push rax",
+}
+
 var eq = []string{
 	"    pop rdi",
 	"    pop rax",
@@ -174,11 +871,22 @@ var le = []string{
 	"    push rax",
 }
 
-var assignRightToLeft = []string{
-	"    pop rdi",        // 右辺値(評価結果)
-	"    pop rax",        // 左辺値のメモリアドレス
-	"    mov [rax], rdi", // ローカル変数のメモリ位置に右辺値をコピーする
-	"    push rdi",       // 代入された値は代入式自体の値になるのでスタックにpushする
+var ltu = []string{
+	"    pop rdi",
+	"    pop rax",
+	"    cmp rax, rdi",
+	"    setb al",
+	"    movzb rax, al",
+	"    push rax",
+}
+
+var leu = []string{
+	"    pop rdi",
+	"    pop rax",
+	"    cmp rax, rdi",
+	"    setbe al",
+	"    movzb rax, al",
+	"    push rax",
 }
 
 var prologue = []string{
@@ -188,7 +896,6 @@ var prologue = []string{
 }
 
 var epilogue = []string{
-	"    pop rax",      // 直前に積まれた値をraxにpopする
 	"    mov rsp, rbp", // ベースポインタの位置までRSPを戻してくる。これによりローカル変数領域が「捨てられる」
 	"    pop rbp",      // 1つ上の関数に対するベースの値をRBPに書き戻す。このpop命令の後、RSPはこの関数のリターンアドレスが書き込まれたメモリアドレスを指している
 	"    ret",          // Stackからpopし、そのpopした値のメモリアドレスに移動する。
@@ -15,6 +15,25 @@ assert() {
     exit 1
   fi
 }
+# 2つ目の引数のプログラムを、3つ目の引数のCソースをコンパイルしたオブジェクトとリンクして実行する
+assert_with() {
+  expected="$1"
+  input="$2"
+  csrc="$3"
+
+  ./main "$input" > tmp.s
+  echo "$csrc" | cc -c -o tmp_with.o -xc -
+  cc -pthread -o tmp tmp.s tmp_with.o
+  ./tmp
+  actual="$?"
+
+  if [ "$actual" = "$expected" ]; then
+    echo "$input => $actual"
+  else
+    echo "$input => $expected expected, but got $actual"
+    exit 1
+  fi
+}
 go test ./...
 
 assert 0 "0;"
@@ -45,5 +64,475 @@ assert 1 'a=1;'
 assert 2 'result=1;a=2;'
 assert 3 'b=1;return 3;'
 assert 5 'return 5;return 8;'
+assert 3 'a=3;return a;'
+assert 7 'a=3;b=4;return a+b;'
+assert 1 'a=1;goto end;a=2;end:return a;'
+assert 2 'a=1;goto mid;end:return a;mid:a=a+1;goto end;'
+assert 5 '{a=2;b=3;}return a+b;'
+assert 20 'a=2;switch(a){case 1:return 10;case 2:return 20;}return 30;'
+assert 30 'a=3;switch(a){case 1:return 10;case 2:return 20;}return 30;'
+assert 3 'a=1;b=0;switch(a){case 1:b=b+1;case 2:b=b+2;break;case 3:b=b+4;}return b;'
+assert 5 'a=9;switch(a){case 1:return 1;default:return 5;}return 0;'
+assert 13 'a=3;b=0;switch(a){case 0:b=10;break;case 1:b=11;break;case 2:b=12;break;case 3:b=13;break;case 4:b=14;break;}return b;'
+assert 99 'a=9;switch(a){case 0:b=10;break;case 1:b=11;break;case 2:b=12;break;case 3:b=13;break;default:b=99;}return b;'
+assert 99 'a=-1;switch(a){case 0:b=10;break;case 1:b=11;break;case 2:b=12;break;case 3:b=13;break;default:b=99;}return b;'
+assert 98 'a=3;switch(a){case 1:b=11;break;case 2:b=12;break;case 4:b=14;break;case 5:b=15;break;default:b=98;}return b;'
+assert 15 'a=-2;switch(a){case -3:b=13;break;case -2:b=15;case -1:break;case 0:b=0;}return b;'
+assert 7 'a=1;b=2;switch(a){case 1:switch(b){case 2:a=7;break;}break;case 7:a=0;}return a;'
+assert 10 'i=0;do i=i+1;while(i<10);return i;'
+assert 1 'i=0;do i=i+1;while(0);return i;'
+assert 3 'i=0;do{i=i+1;continue;i=100;}while(i<3);return i;'
+assert 12 'i=0;s=0;do{i=i+1;switch(i){case 3:continue;}s=s+i;}while(i<5);return s;'
+assert 1 'i=0;do{i=i+1;break;}while(1);return i;'
+assert 4 'i=0;do{i=i+1;switch(i){case 2:break;}}while(i<4);return i;'
+assert 3 'int x;int *p;p=&x;*p=3;return x;'
+assert 7 'struct {int x;int y;} p;p.x=3;p.y=4;return p.x+p.y;'
+assert 12 'struct point {int x;int y;};struct point a;struct point b;a.x=1;a.y=2;b=a;return b.x*10+b.y;'
+assert 1 'struct point {int x;int y;} a, b;a.x=1;b=a;a.x=9;return b.x;'
+assert 5 'struct point {int x;int y;} a;struct point *p;p=&a;p->y=5;return a.y;'
+assert 9 'struct {int a;struct {int b;int c;} in;} s;s.in.c=9;return s.in.c;'
+assert 6 'struct node {int v;struct node *next;} a, b;a.next=&b;b.v=6;return a.next->v;'
+assert 8 'struct {int a;struct {int b;int c;} in;} s, t;s.in.b=3;s.in.c=5;t.in=s.in;return t.in.b+t.in.c;'
+assert 7 'union {int a;int b;} u;u.a=7;return u.b;'
+assert 3 'union u {int a;struct {int x;int y;} s;} v, w;v.s.x=3;w=v;return w.a;'
+assert 2 'enum {A, B, C};return C;'
+assert 11 'enum color {RED=10, GREEN, BLUE=RED+5};enum color c;c=GREEN;return c;'
+assert 1 'enum {X=-1, Y, Z,};return Y+Z;'
+assert 20 'enum {A=1, B};switch(2){case A:return 10;case B:return 20;}return 0;'
+assert 3 'typedef int T;T x;x=3;return x;'
+assert 4 'typedef struct {int x;int y;} P;P a;a.y=4;return a.y;'
+assert 5 'typedef struct node Node;struct node {int v;Node *next;};Node a, b;a.next=&b;b.v=5;return a.next->v;'
+assert 6 'typedef int A, *B;A x;B y;y=&x;*y=6;return x;'
+assert 1 'int a;a=1;{int a;a=2;}return a;'
+assert 3 '{b=3;}return b;'
+assert 4 'struct s {int a;} x;{struct s {int a;int b;} y;y.b=4;x.a=y.b;}return x.a;'
+assert 2 'typedef int T;{int T;T=5;}T y;y=2;return y;'
+assert 3 'typedef int T;goto T;T:return 3;'
+assert 7 'enum {A=1};{enum {A=7};return A;}'
+assert 1 'short s;s=65535;return s==-1;'
+assert 1 'unsigned short u;u=65535;return u==65535;'
+assert 0 'unsigned int u;int i;u=1;i=-1;return i<u;'
+assert 1 'int i;long l;i=-1;l=1;return i<l;'
+assert 1 'unsigned long x;x=0;x=x-1;return x/2>0;'
+assert 1 'int a;short b;long c;a=-1;b=a;c=b;return c==-1;'
+assert 1 'unsigned int a;long c;a=-1;c=a;return c==4294967295;'
+assert 0 'unsigned int a;a=4294967295;a=a+1;return a;'
+assert 1 'long l;l=4294967296;return l/4294967296;'
+assert 6 'struct {short a;int b;long c;} s;s.a=1;s.b=2;s.c=3;return s.a+s.b+s.c;'
+assert 3 'long long a;unsigned long long b;a=1;b=2;return a+b;'
+assert 1 'short a;short b;a=1;b=-1;return a;'
+assert 1 'return (short)65537;'
+assert 1 'return (unsigned short)-1==65535;'
+assert 1 'return (int)4294967297;'
+assert 1 'return (long)(short)-1==-1;'
+assert 1 'return (long)(unsigned short)-1==65535;'
+assert 1 'return (unsigned)-1>0;'
+assert 1 'return (int)2147483648<0;'
+assert 1 'return (long)(unsigned)-1==4294967295;'
+assert 3 'int a;long p;a=3;p=(long)&a;return *(int*)p;'
+assert 7 'long a;int *p;a=7;p=(int*)&a;return *p;'
+assert 2 'typedef short T;return (T)65538;'
+assert 5 'return -(long)-5;'
+assert 15 'double x;x=1.5;float y;y=2.25f;return (x+y)*4;'
+assert 3 'return 3.99;'
+assert 2 'return 0.5+1.5e0;'
+assert 5 'return .5*10;'
+assert 1 'return 1e3==1000;'
+assert 1 'return 0.1+0.2!=0.3;'
+assert 1 'float f;f=0.1;return f!=0.1;'
+assert 1 'double d;d=-2.5;return d<-2;'
+assert 0 'double d;d=2.5;return d<=2;'
+assert 1 'return 2.5>2;'
+assert 1 'return 1>=1.0f;'
+assert 7 'int i;double d;i=7;d=i;return d;'
+assert 3 'double d;d=10;return d/3;'
+assert 1 'return (double)(unsigned long)-1==18446744073709551615.0;'
+assert 1 'unsigned long u;u=-1;double d;d=u;return d>1e19;'
+assert 4 'float f;double d;d=4.75;f=d;return (long)f;'
+assert 1 'short s;s=-1.5;return s==-1;'
+assert 2 'int n;double d;n=0;d=0.5;do n=n+1;while(d=d-0.25);return n;'
+assert 1 'int n;double d;n=0;d=-1;do {n=n+1;d=d*0;} while(d);return n;'
+assert 3 'int a[3];a[0]=1;a[1]=2;a[2]=3;return a[2];'
+assert 6 'int a[3];a[0]=1;a[1]=2;a[2]=3;return a[0]+a[1]+a[2];'
+assert 2 'int a[3];int *p;p=a;*(p+1)=2;return a[1];'
+assert 3 'int a[4];int *p;int *q;p=a;q=a+3;return q-p;'
+assert 5 'long a[2];a[1]=5;return *(a+1);'
+assert 4 'short a[3];a[2]=4;return *(2+a);'
+assert 7 'struct {int x;int y;} a[2];a[1].y=7;return a[1].y;'
+assert 9 'struct {int n;int v[3];} s;s.v[2]=9;return s.v[2];'
+assert 3 'int a = 3;return a;'
+assert 5 'int a = 2, b = a + 3;return b;'
+assert 6 'int a[3] = {1, 2, 3};return a[0]+a[1]+a[2];'
+assert 0 'int a[3] = {1};return a[1]+a[2];'
+assert 3 'int a[] = {1, 2, 3,};int *p;p=&a[0];return &a[3]-p;'
+assert 5 'int a[5] = {[3] = 4, 5};return a[4];'
+assert 4 'int a[5] = {[3] = 4, 5};return a[3]+a[0]+a[1]+a[2];'
+assert 3 'int a[] = {[2] = 3};int *p;p=a;return &a[3]-p;'
+assert 3 'struct {int x;int y;} s = {1, 2};return s.x+s.y;'
+assert 2 'struct {int x;int y;} s = {.y = 2};return s.x+s.y;'
+assert 7 'struct {int x;int y;int z;} s = {.y = 2, 5};return s.y+s.z;'
+assert 8 'struct {int x;struct {int a;int b;} in;} s = {1, {2, 3}};return s.x+s.in.a*2+s.in.b;'
+assert 6 'struct {int x;struct {int a;int b;} in;} s = {1, 2, 3};return s.x+s.in.a+s.in.b;'
+assert 8 'struct {int x;struct {int a;int b;} in;} s = {.in.b = 8};return s.in.b+s.in.a+s.x;'
+assert 10 'struct p {int x;int y;} a[2] = {{1, 2}, {3, 4}};return a[0].x+a[0].y+a[1].x+a[1].y;'
+assert 10 'struct p {int x;int y;} a[2] = {1, 2, 3, 4};return a[0].x+a[0].y+a[1].x+a[1].y;'
+assert 4 'struct p {int x;int y;} a[2] = {[1].y = 4};return a[1].y+a[0].x;'
+assert 3 'struct p {int x;int y;} a = {1, 2};struct p b = a;return b.x+b.y;'
+assert 2 'union {int i;short s;} u = {.s = 2};return u.i;'
+assert 1 'union {short s;int i;} u = {1};return u.i;'
+assert 3 'int x = {3};return x;'
+assert 2 'double d[2] = {1.5, 0.5};return d[0]+d[1];'
+assert 0 'int a[2];a[0]=5;a[1]=6;{int a[2] = {};return a[0]+a[1];}'
+assert 8 'int (*f)(int, int);int (*g)(int, int);f=(int (*)(int, int))8;g=f;return (long)g;'
+assert 1 'int (*f)(int);int (*g)(int);f=(int (*)(int))8;g=(int (*)(int))8;return f==g;'
+assert 5 'int (*fps[3])(int);fps[2]=(int (*)(int))5;return (long)fps[2];'
+assert 3 'int (*fps[3])(int) = {0, 0, (int (*)(int))3};return (long)fps[2];'
+assert 7 'typedef int (*Handler)(long *, int);Handler h;h=(Handler)7;return (long)h;'
+assert 4 'int *(a);a=(int *)4;return (long)a;'
+assert 6 'struct {int id;int (*cb)(int);} t = {6};return t.id+(long)t.cb;'
+assert 4 'return sizeof(int);'
+assert 8 'int *p;return sizeof p;'
+assert 48 'int a[3][4];return sizeof(a);'
+assert 16 'int a[3][4];return sizeof(a[0]);'
+assert 4 'int a[3][4];return sizeof(a[0][0]);'
+assert 8 'int a[3][4];return sizeof(a[0]+1);'
+assert 96 'return sizeof(long[3][4]);'
+assert 24 'return sizeof(int *[3]);'
+assert 8 'return sizeof(int (*)[3]);'
+assert 12 'int (*p)[3];return sizeof *p;'
+assert 7 'int a[3][4];a[2][3]=7;return a[2][3];'
+assert 11 'int a[2][3];int *p;p=a;p[5]=11;return a[1][2];'
+assert 5 'int a[3][4];int (*p)[4];p=a;p[1][2]=5;return a[1][2];'
+assert 5 'int a[3][4];int (*p)[4];p=a+1;(*p)[2]=5;return a[1][2];'
+assert 16 'int a[3][4];return (long)(&a[1]) - (long)(&a[0]);'
+assert 1 'int a[3][4];return &a[2]-&a[1];'
+assert 9 'int x;int y;int *a[2];a[0]=&x;a[1]=&y;*a[1]=9;return y;'
+assert 21 'int a[2][3] = {{1, 2, 3}, {4, 5, 6}};return a[0][0]+a[0][1]+a[0][2]+a[1][0]+a[1][1]+a[1][2];'
+assert 21 'int a[2][3] = {1, 2, 3, 4, 5, 6};return a[0][0]+a[0][1]+a[0][2]+a[1][0]+a[1][1]+a[1][2];'
+assert 6 'int a[][2] = {{1, 2}, {3}, [2][1] = 6};return a[2][1];'
+assert 24 'int a[][2] = {{1, 2}, {3}, [2][1] = 6};return sizeof a;'
+assert 3 'int a[2][2][2];a[1][0][1]=3;return a[1][0][1];'
+assert 32 'int a[2][2][2];return sizeof a;'
+assert 2 'return sizeof(short)+sizeof 1-sizeof(int);'
+assert 4 'struct {int a[2][2];} s;s.a[1][1]=4;return s.a[1][1];'
+assert 8 'int i;int *p;i=0;do {static int n = 5;n=n+1;i=i+1;p=&n;} while(i<3);return *p;'
+assert 6 'int i;int *p;i=0;do {int n = 5;n=n+1;i=i+1;p=&n;} while(i<3);return *p;'
+assert 3 'int i;int *p;i=0;do {static int n;n=n+1;i=i+1;p=&n;} while(i<3);return *p;'
+assert 1 'static int a;int b;static int c;a=1;b=2;c=3;return a+b-c+1;'
+assert 10 'static int a[] = {1, 2, 3, 4};return a[0]+a[1]+a[2]+a[3];'
+assert 16 'static int a[] = {1, 2, 3, 4};return sizeof a;'
+assert 7 'static struct {short s;long l;} x = {.l = 7};return x.l+x.s;'
+assert 3 'static double d = 1.5 * 2;return d;'
+assert 2 'static float f = 2.5f;return f;'
+assert 255 'static unsigned short u = -1;return u/257;'
+assert 1 'static int x = (short)65537;return x;'
+assert 4 'static int x = 4.9;return x;'
+assert 5 'static int x = 5;{int x = 1;}return x;'
+assert 2 'static int x = 1;int *p;p=&x;*p=2;return x;'
+assert 1 'extern int opterr;return opterr;'
+assert 9 'extern int opterr;int *p;p=&opterr;*p=9;return opterr;'
+assert 3 'const int x = 3;return x;'
+assert 5 'int const x = 2;const int *p = &x;return *p+3;'
+assert 7 'int x = 1;int *const p = &x;*p = 7;return x;'
+assert 4 'const struct {int a;int b;} s = {1, 3};return s.a+s.b;'
+assert 6 'volatile int x = 6;volatile int *p = &x;return *p;'
+assert 2 'typedef const long T;T a[2] = {1, 1};const long *p = a;return p[0]+p[1];'
+assert 8 'int x = 8;const int *p = &x;return *p;'
+assert 9 'static const int x = 9;return x;'
+assert 4 'return sizeof(const int);'
+assert 31 'return 0x1F;'
+assert 255 'return 0XfF;'
+assert 15 'return 017;'
+assert 0 'return 0;'
+assert 5 'return 0b101;'
+assert 10 'return 012u;'
+assert 4 'return sizeof(1u);'
+assert 8 'return sizeof(1l);'
+assert 8 'return sizeof(1LL);'
+assert 8 'return sizeof(0x100000000);'
+assert 4 'return sizeof(0xFFFFFFFF);'
+assert 0 'return -1 < 0u;'
+assert 1 'return -1 < 0;'
+assert 0 'return -1 < 0xFFFFFFFF;'
+assert 1 'return -1 < 0x7FFFFFFF;'
+assert 1 'return 0xFFFFFFFFFFFFFFFF == -1;'
+assert 128 'return 0xFFFFFFFFFFFFFFFF / 0x200000000000000 + 1;'
+assert 1 'unsigned long x = 18446744073709551615u;return x / 18446744073709551615ul;'
+assert 7 'int x_1 = 3;int _y = 4;return x_1+_y;'
+assert 1 '_Bool b;b=2;return b;'
+assert 0 '_Bool b;b=0;return b;'
+assert 1 '_Bool b = 256;return b;'
+assert 1 '_Bool b = 0.5;return b;'
+assert 0 '_Bool b = -0.0;return b;'
+assert 1 'int x;int *p = &x;_Bool b = p;return b;'
+assert 1 'return (_Bool)-1;'
+assert 1 'return sizeof(_Bool);'
+assert 2 'bool a = true;bool b = 3;return a+b;'
+assert 0 'bool b = false;return b;'
+assert 3 '_Bool a[3] = {1, 2, 3};return a[0]+a[1]+a[2];'
+assert 1 'static _Bool b = 42;return b;'
+assert 1 'static _Bool b = 0.1;return b;'
+assert 3 'struct {_Bool a;_Bool b;short c;} s;return sizeof(s)-1;'
+assert 255 '_Bool b = 1;unsigned short u = 255;return b*u;'
+assert 3 'return (int){3};'
+assert 6 'int *p = (int[]){1, 2, 3};return p[0]+p[1]+p[2];'
+assert 12 'return sizeof((int[]){1, 2, 3});'
+assert 3 'struct point {int x;int y;};return (struct point){1, 2}.x+(struct point){1, 2}.y;'
+assert 5 'struct point {int x;int y;};struct point *p = &(struct point){.y = 5};return p->y+p->x;'
+assert 7 'int *p = &(int){1};*p = 7;return *p;'
+assert 9 '(int){1} = 9;return 9;'
+assert 4 'struct point {int x;int y;} q = (struct point){3, 1};return q.x+q.y;'
+assert 2 'return (int[]){1, 2, 3}[1];'
+assert 1 'return (_Bool){5};'
+assert 3 'return ({ 1; 2; 3; });'
+assert 6 'return ({ int x = 2; int y = 4; x + y; });'
+assert 5 'int x = ({ int y = 5; y; });return x;'
+assert 3 'int x = 1;({ int x = 2; x = 3; });return x + 2;'
+assert 8 'return ({ int a[2] = {3, 5}; a[0]; }) + ({ 5; });'
+assert 2 'struct s {int a;int b;};return ({ struct s v = {1, 2}; v; }).b;'
+assert 4 'long x = ({ long y; switch (2) { case 2: y = 4; } y; });return x;'
+assert 4 'struct {unsigned a:3; unsigned b:5; int c:20;} s;return sizeof(s);'
+assert 8 'struct {short a; int b:20;} s;return sizeof(s);'
+assert 8 'struct {int a:3; long b:61;} s;return sizeof(s);'
+assert 5 'struct {_Bool x; int :0; _Bool y;} s;return sizeof(s);'
+assert 8 'struct {int a:4; int :0; int b:4;} s;return sizeof(s);'
+assert 2 'struct {_Bool a:1; _Bool b:1; short c:9;} s;return sizeof(s);'
+assert 16 'struct {long a:40; int b:30;} s;return sizeof(s);'
+assert 4 'union {int a:3; _Bool c;} u;return sizeof(u);'
+assert 3 'struct {_Bool a; int :4; _Bool b;} s;return sizeof(s);'
+assert 8 'struct {unsigned long long a:33; unsigned b:31;} s;return sizeof(s);'
+assert 5 'struct {unsigned a:3; unsigned b:5; int c:20;} s;s.a = 5;s.b = 17;s.c = -3;return s.a;'
+assert 17 'struct {unsigned a:3; unsigned b:5; int c:20;} s;s.a = 5;s.b = 17;s.c = -3;return s.b;'
+assert 3 'struct {unsigned a:3; unsigned b:5; int c:20;} s;s.a = 5;s.b = 17;s.c = -3;return -s.c;'
+assert 1 'struct {unsigned a:3; unsigned b:5; int c:20;} s = {5, 17, -3};unsigned *p = (unsigned *)&s;return *p == 268434829;'
+assert 1 'static struct {unsigned a:3; unsigned b:5; int c:20;} s = {5, 17, -3};unsigned *p = (unsigned *)&s;return *p == 268434829;'
+assert 1 'struct {long a:40; int b:30;} g = {-2, 7};long *p = (long *)&g;return p[0] == 1099511627774;'
+assert 7 'struct {long a:40; int b:30;} g = {-2, 7};long *p = (long *)&g;return p[1];'
+assert 7 'struct {unsigned a:3;} s;return s.a = 15;'
+assert 255 'struct {int a:3;} s;s.a = 7;return s.a;'
+assert 1 'struct {int a:3;} s;s.a = 7;return s.a == -1;'
+assert 3 'struct {unsigned a:2; unsigned b:2;} s = {.b = 3};return s.b + s.a;'
+assert 12 'struct {unsigned a:2; unsigned b:2;} s = {3, 3};s.a = 0;unsigned *p = (unsigned *)&s;return *p;'
+assert 1 'struct {_Bool b:1;} s;s.b = 4;return s.b;'
+assert 9 'struct {unsigned x:4; unsigned y:4;} s;struct {unsigned x:4; unsigned y:4;} *p = &s;p->x = 4;p->y = 5;return p->x + s.y;'
+assert 1 'struct {unsigned long long a:64;} s;s.a = -1;return s.a == -1;'
+assert 4 'return _Alignof(int);'
+assert 8 'return _Alignof(long);'
+assert 1 'return _Alignof(_Bool);'
+assert 4 'return _Alignof(struct {short a; int b;});'
+assert 2 'return _Alignof(short[3]);'
+assert 8 'int *p;return _Alignof p;'
+assert 1 '_Alignas(16) int x;long p = (long)&x;return (p / 16) * 16 == p;'
+assert 1 'int a;_Alignas(16) short x;int b;long p = (long)&x;return (p / 16) * 16 == p;'
+assert 16 '_Alignas(16) int x;return _Alignof(x);'
+assert 8 'int _Alignas(long) x;return _Alignof x;'
+assert 16 'struct {_Alignas(16) int a;} s;return sizeof(s);'
+assert 16 'struct {int a;_Alignas(8) int b;} s;return sizeof(s);'
+assert 8 'struct {int a;_Alignas(8) int b;} s;return (long)&s.b - (long)&s;'
+assert 1 'static _Alignas(64) int x;long p = (long)&x;return (p / 64) * 64 == p;'
+assert 1 'static _Alignas(32) int a[] = {1, 2};long p = (long)a;return (p / 32) * 32 == p;'
+assert 1 '_Static_assert(sizeof(int) == 4, "int is 4 bytes");return 1;'
+assert 2 '_Static_assert(_Alignof(long) == 8);return 2;'
+assert 4 'struct {int a; _Static_assert(1, "ok");} s;return sizeof(s);'
+assert 3 'enum {N = 3};_Static_assert(N * 2 == 6, "N");return N;'
+assert 2 'return _Generic(1, long: 1, int: 2, default: 3);'
+assert 3 'return _Generic(1.0, long: 1, int: 2, default: 3);'
+assert 8 'double d = 2;return _Generic(d, float: 4, double: 8) * d / 2;'
+assert 5 'int x = 5;int *p = &x;return _Generic(p, int *: *p, default: 0);'
+assert 1 'int x = 0;return _Generic(x = 7, int: 1, default: 2) + x;'
+assert 7 'int x = 3;return _Generic(x, int: ({ x = x + 4; x; }), long: 0);'
+assert 7 'static _Thread_local int x = 3;x = x + 4;return x;'
+assert 5 'static __thread long a[2];a[1] = 5;return a[0] + a[1];'
+assert 6 'static _Thread_local struct {short c;int i;} s = {1, 2};int *p = &s.i;*p = *p + 3;return s.c + s.i;'
+assert_with 4 'extern _Thread_local int counter;counter = counter + 1;return counter;' '
+#include <pthread.h>
+_Thread_local int counter = 3;
+static void *worker(void *arg) { counter = 40; return arg; }
+__attribute__((constructor)) static void spawn(void) {
+  pthread_t t;
+  pthread_create(&t, 0, worker, 0);
+  pthread_join(t, 0);
+}'
+assert 5 '_Atomic int x = 2;x = 5;return x;'
+assert 4 '_Atomic(long) x = 1;_Atomic long *_Atomic p = 0;p = &x;return sizeof(x) / 2 + *p + atomic_load(&x) - 2;'
+assert 7 'int x = 3;__atomic_store_n(&x, 7, __ATOMIC_RELEASE);return __atomic_load_n(&x, __ATOMIC_ACQUIRE);'
+assert 3 'long x = 3;return __atomic_exchange_n(&x, 9, __ATOMIC_SEQ_CST);'
+assert 9 'long x = 3;atomic_exchange(&x, 9);return x;'
+assert 3 'bool b = 0;return atomic_exchange(&b, 7) + b + 2;'
+assert 13 'short x = 10;return __atomic_fetch_add(&x, 3, __ATOMIC_RELAXED) + x - 10;'
+assert 3 'int x = 10;return atomic_fetch_sub(&x, 3) - x;'
+assert 255 'unsigned short x = 0;return __atomic_fetch_sub(&x, 1, __ATOMIC_SEQ_CST) + x - 65280;'
+assert 1 'int x = 10;int e = 10;return __atomic_compare_exchange_n(&x, &e, 20, 0, __ATOMIC_SEQ_CST, __ATOMIC_SEQ_CST);'
+assert 20 'int x = 10;int e = 10;atomic_compare_exchange_strong(&x, &e, 20);return x;'
+assert 0 'int x = 10;int e = 3;return atomic_compare_exchange_weak_explicit(&x, &e, 20, memory_order_acq_rel, memory_order_acquire);'
+assert 20 'int x = 10;int e = 3;atomic_compare_exchange_weak(&x, &e, 20);return x + e;'
+assert 5 'long x = 4;long *p = 0;long *e = 0;return atomic_compare_exchange_strong(&p, &e, &x) + *p;'
+assert 0 'atomic_thread_fence(memory_order_seq_cst);__atomic_thread_fence(__ATOMIC_ACQUIRE);'
+assert_with 1 'extern long counter;extern int done;long i = 0;do {__atomic_fetch_add(&counter, 1, __ATOMIC_RELAXED);i = i + 1;} while (i < 1000000);do {} while (__atomic_load_n(&done, __ATOMIC_ACQUIRE) == 0);return counter == 2000000;' '
+#include <pthread.h>
+long counter;
+int done;
+static void *worker(void *arg) {
+  for (int i = 0; i < 1000000; i++)
+    __atomic_fetch_add(&counter, 1, __ATOMIC_RELAXED);
+  __atomic_store_n(&done, 1, __ATOMIC_RELEASE);
+  return arg;
+}
+__attribute__((constructor)) static void spawn(void) {
+  pthread_t t;
+  pthread_create(&t, 0, worker, 0);
+  pthread_detach(t);
+}'
+assert_with 1 'extern long buf[16];extern long head;extern long tail;long sum = 0;long t = 0;do {do {} while (atomic_load_explicit(&head, memory_order_acquire) == t);sum = sum + buf[t - (t / 16) * 16];t = t + 1;atomic_store_explicit(&tail, t, memory_order_release);} while (t < 100000);return sum == 5000050000;' '
+#include <pthread.h>
+#include <stdatomic.h>
+long buf[16];
+long head, tail;
+static void *producer(void *arg) {
+  for (long i = 1; i <= 100000; i++) {
+    while (i - 1 - atomic_load_explicit(&tail, memory_order_acquire) >= 16)
+      ;
+    buf[(i - 1) % 16] = i;
+    atomic_store_explicit(&head, i, memory_order_release);
+  }
+  return arg;
+}
+__attribute__((constructor)) static void spawn(void) {
+  pthread_t t;
+  pthread_create(&t, 0, producer, 0);
+  pthread_detach(t);
+}'
+assert 3 'asm("mov rax, 3");'
+assert 3 'asm volatile("nop\n\t" "nop");3;'
+assert 7 'int x;asm("mov %0, 7" : "=r"(x));return x;'
+assert 9 'int x = 4;asm("add %0, 5" : "+r"(x));return x;'
+assert 12 'long x;long y = 5;asm("lea %0, [%1 + 7]" : "=r"(x) : "r"(y));return x;'
+assert 6 'long x = 2;asm("imul %[v], %[v], 3" : [v] "+r"(x));return x;'
+assert 11 'int x = 1;asm("add %0, 10" : "+m"(x));return x;'
+assert 8 'int x = 3;int y;asm("mov %0, %1\n\tadd %0, 5" : "=&r"(y) : "m"(x));return y;'
+assert 20 'long x = 10;long y;asm("lea %0, [%1 + %1]" : "=r"(y) : "0"(x));return y;'
+assert 4 'long b;asm("mov rbx, 4\n\tmov %0, rbx" : "=r"(b) : : "rbx");return b;'
+assert 1 'short s;asm("mov %w0, -1\n\tmov %k0, 1" : "=r"(s));return s;'
+assert 1 'long t1;long t2;asm volatile("rdtsc\n\tshl rdx, 32\n\tor rax, rdx" : "=a"(t1) : : "rdx");asm volatile("rdtsc\n\tshl rdx, 32\n\tor rax, rdx" : "=a"(t2) : : "rdx");return t1 <= t2;'
+assert 1 'long pid;asm volatile("syscall" : "=a"(pid) : "a"(39) : "rcx", "r11", "memory");return pid > 0;'
+assert 42 'asm volatile("syscall" : : "a"(60), "D"(42));return 0;'
+
+assert 3 '#define THREE 3
+return THREE;'
+assert 7 '#define ADD(a, b) ((a) + (b))
+return ADD(3, 4);'
+assert 12 '#define SQ(x) ((x) * (x))
+#define TWICE(x) (x + x)
+return TWICE(SQ(2)) + SQ(2);'
+assert 5 '#define f(x) (x + f)
+int f = 2;
+return f(3);'
+assert 4 'int a = 3;
+#define a a + 1
+return a;'
+assert 6 '#define CAT(a, b) a ## b
+int xy = 6;
+return CAT(x, y);'
+assert 42 '#define N 4 ## 2
+return N;'
+assert 3 '#define ASM(...) asm(#__VA_ARGS__)
+ASM(mov rax, 3);'
+assert 5 '#define ASM(...) asm(#__VA_ARGS__)
+ASM(  mov   rax ,
+  5  );'
+assert 3 '#define SUM(...) sum3(__VA_ARGS__)
+#define sum3(a, b, c) (a + b + c)
+return SUM(0, 1, 2);'
+assert 2 '#define FIRST(x, ...) x
+return FIRST(2, 3, 4);'
+assert 3 '#define COUNT(fmt, ...) count(fmt, ## __VA_ARGS__)
+#define count(...) sizeof((long[]){__VA_ARGS__}) / 8
+return COUNT(1) + COUNT(1, 2);'
+assert 1 '#define X 1
+int y = X;
+#undef X
+int X = 2;
+return y;'
+assert 6 '#define LONG_EXPR 1 + \
+  2 + 3
+return LONG_EXPR;'
+assert 9 '#define EMPTY
+#define ID(x) x
+return ID() 9 EMPTY;'
+assert 5 '#define ADD(a, b) a ## b + 5
+return ADD(,);'
+assert 10 'double d;d=1e19;unsigned long u;u=d;return u/1000000000000000000;'
+assert 13 'float f = 13835058055282163712.0f;unsigned long u = f;return u/1000000000000000000;'
+assert 3 'double d = 3.7;unsigned long u = d;return u;'
+assert 1 'double d = -0.0;return 1/d < 0;'
+assert 1 'float f = -0.0f;return 1/f < 0;'
+assert 1 'double z = 0.0;double m = -z;return 1/m < 0;'
+assert 1 'static double d = -0.0;return 1/d < 0;'
+assert 3 'double d = 1.5;return -d * -2;'
+assert 12 'struct S {int a;int b;};struct T {struct S s;int c;} t = { ({ goto L; L: 3; 3; }), 4, 5 };return t.s.a+t.s.b+t.c;'
+assert 9 'struct S {int a;int b;};struct S u = {1, 2};struct T {struct S s;int c;} t = { ({ int x = 0; u; }), 6 };return t.s.a+t.s.b+t.c;'
+assert 5 'goto L;int x = 5;L: return x;'
+assert 7 'int si = 3;short al = 4;return si + al;'
+assert 20 'int a[] = {1, [3] = 4};return sizeof(a) + a[3];'
+assert 6 'struct {int x;struct {short y;short z;} s;} g = {1, 2, 3};return g.x + g.s.y + g.s.z;'
+assert 8 'int k = 2;struct {int a;int b;} s = {k, k*3};return s.a + s.b;'
+assert 11 'int k = 5;_Thread_local int ta[2] = {k, k+1};return ta[0] + ta[1];'
+assert 4 '_Thread_local int t = 4;return t;'
+assert_with 7 'int g = 7;extern int *gp;return *gp;' '
+extern int g;
+int *gp = &g;
+'
+
+assert_with 7 'int add(int, int);return add(3, 4);' '
+int add(int a, int b) { return a + b; }
+'
+assert_with 10 'int add(int, int);int (*fp)(int, int) = add;return fp(3, 4) + (*fp)(1, 1) + (&add)(0, 1);' '
+int add(int a, int b) { return a + b; }
+'
+assert_with 4 '{int add(int, int);int add(int, int);return add(add(1, 1), 2);}' '
+int add(int a, int b) { return a + b; }
+'
+assert_with 21 'long sum6(long, long, long, long, long, long);return sum6(1, 2, 3, 4, 5, 6);' '
+long sum6(long a, long b, long c, long d, long e, long f) { return a + b + c + d + e + f; }
+'
+assert_with 9 'double scale(double, float, int);return scale(1.5, 2, 3);' '
+double scale(double x, float y, int n) { return x * y * n; }
+'
+assert_with 5 'float half(float);long n = 3;return half(n) * 2 + half(4.0);' '
+float half(float x) { return x / 2; }
+'
+assert_with 3 'double twice();float f = 1.5f;return twice(f);' '
+double twice(double x) { return 2 * x; }
+'
+assert_with 2 'short minus1(int);_Bool isodd(int);return minus1(0) + 2 + isodd(3) + isodd(4);' '
+short minus1(int x) { return x - 1; }
+_Bool isodd(int x) { return x % 2; }
+'
+assert_with 4 'int aligned(int);return aligned(1) + (1 + (2 * aligned(1)));' '
+int aligned(int x) { return ((long)__builtin_frame_address(0) & 15) == 0 ? x : 100; }
+'
+assert_with 25 'extern int (*op)(int);return op(5);' '
+static int square(int x) { return x * x; }
+int (*op)(int) = square;
+'
 
+assert 10 'static unsigned long u = (unsigned long)1e19;return u / 1000000000000000000;'
+assert 10 'unsigned long g = 1e19;_Static_assert((unsigned long)1e19 == 10000000000000000000u, "");return g / 1000000000000000000;'
+assert 18 'static double d = 18446744073709551615u;return d / 1e18;'
+assert 7 'static int x = 3;{extern int x;x = x + 4;}return x;'
+assert 3 'int si = 2;{extern int si;{extern int si;return si + 1;}}'
+assert 10 'const struct S *p;struct S {int a;int b;};struct S s = {1, 2};p = &s;return sizeof(*p) + p->b;'
+assert 11 'typedef const struct S CS;struct S {int a;int b;};CS s = {1, 2};return sizeof(CS) + s.a + s.b;'
+assert 24 'volatile struct T *p = 0;struct T {long a[3];};return (long)(p + 1);'
+assert 5 '#undef true
+int true = 5;return true;'
+assert 7 'int x = 3;({ x = x + 1; return 7; });return x;'
+assert 5 '({ goto E; 1; E: 5; });'
+assert 9 'int x = 0;({ ({ x = 9; {} }); });return x;'
+assert_with 6 'int twice(const int);int (*fp)(int) = twice;return fp(3);' '
+int twice(int x) { return 2 * x; }
+'
+assert 7 'unsigned x=4294967295;switch(x){case -1:return 7;}return 1;'
+assert 7 'short s=-1;switch(s){case 65535:return 1;case -1:return 7;}return 0;'
+assert 12 'unsigned x=4294967294;switch(x){case -3:return 11;case -2:return 12;case -1:return 13;case -4:return 14;}return 0;'
 echo OK